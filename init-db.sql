@@ -3,5 +3,112 @@
 CREATE TABLE minters (
     id SERIAL PRIMARY KEY,
     address VARCHAR(255) UNIQUE,
-    status INT
-);
\ No newline at end of file
+    status INT,
+    label VARCHAR(255),
+    block_number BIGINT,
+    tx_hash VARCHAR(66)
+);
+
+CREATE UNIQUE INDEX minters_address_lower_idx ON minters (lower(address));
+
+CREATE TABLE transfers (
+    id SERIAL PRIMARY KEY,
+    contract_address VARCHAR(42) NOT NULL,
+    tx_hash VARCHAR(66) NOT NULL,
+    log_index INT NOT NULL,
+    block_number BIGINT NOT NULL,
+    block_hash VARCHAR(66) NOT NULL,
+    from_address VARCHAR(42) NOT NULL,
+    to_address VARCHAR(42) NOT NULL,
+    token_id NUMERIC(78, 0) NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    status INT NOT NULL DEFAULT 0,
+    UNIQUE (tx_hash, log_index)
+);
+
+CREATE TABLE checkpoints (
+    contract_address VARCHAR(42) PRIMARY KEY,
+    block_number BIGINT NOT NULL
+);
+
+CREATE TABLE events (
+    id SERIAL PRIMARY KEY,
+    contract_address VARCHAR(42) NOT NULL,
+    event_name VARCHAR(64) NOT NULL,
+    tx_hash VARCHAR(66) NOT NULL,
+    log_index INT NOT NULL,
+    block_number BIGINT NOT NULL,
+    block_hash VARCHAR(66) NOT NULL,
+    block_timestamp BIGINT,
+    tx_from VARCHAR(42),
+    gas_used BIGINT,
+    effective_gas_price NUMERIC(78, 0),
+    data JSONB NOT NULL,
+    UNIQUE (tx_hash, log_index)
+);
+
+CREATE TABLE webhook_deliveries (
+    id SERIAL PRIMARY KEY,
+    url TEXT NOT NULL,
+    event_key VARCHAR(150) NOT NULL,
+    event_name VARCHAR(64) NOT NULL,
+    block_number BIGINT NOT NULL,
+    payload TEXT NOT NULL,
+    replay BOOLEAN NOT NULL DEFAULT FALSE,
+    status INT NOT NULL DEFAULT 0,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    delivered_at TIMESTAMPTZ,
+    UNIQUE (url, event_key)
+);
+
+CREATE TABLE tokens (
+    contract_address VARCHAR(42) NOT NULL,
+    token_id NUMERIC(78, 0) NOT NULL,
+    owner VARCHAR(42) NOT NULL,
+    minted_block BIGINT,
+    mint_tx_hash VARCHAR(66),
+    last_block BIGINT NOT NULL,
+    last_log_index INT NOT NULL,
+    PRIMARY KEY (contract_address, token_id)
+);
+
+CREATE VIEW balances AS
+    SELECT contract_address, owner AS address, COUNT(*) AS balance
+    FROM tokens
+    WHERE owner <> '0x0000000000000000000000000000000000000000'
+    GROUP BY contract_address, owner;
+
+CREATE TABLE token_metadata (
+    contract_address VARCHAR(42) NOT NULL,
+    token_id NUMERIC(78, 0) NOT NULL,
+    uri TEXT,
+    metadata JSONB,
+    status INT NOT NULL DEFAULT 0,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMPTZ,
+    PRIMARY KEY (contract_address, token_id),
+    FOREIGN KEY (contract_address, token_id) REFERENCES tokens (contract_address, token_id) ON DELETE CASCADE
+);
+
+CREATE TABLE transactions (
+    id SERIAL PRIMARY KEY,
+    chain_id BIGINT NOT NULL,
+    sender VARCHAR(42) NOT NULL,
+    nonce BIGINT NOT NULL,
+    tx_hash VARCHAR(66) NOT NULL UNIQUE,
+    action VARCHAR(16) NOT NULL,
+    target VARCHAR(42),
+    payload TEXT NOT NULL,
+    status INT NOT NULL DEFAULT 0,
+    block_number BIGINT,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX transactions_sender_nonce_idx ON transactions (chain_id, sender, nonce);
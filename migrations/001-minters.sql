@@ -0,0 +1,22 @@
+\c erc_721_checks;
+
+-- Brings a minters table created before labels and on-chain role tracking up
+-- to date. It can be run more than once.
+
+ALTER TABLE minters ADD COLUMN IF NOT EXISTS label VARCHAR(255);
+ALTER TABLE minters ADD COLUMN IF NOT EXISTS block_number BIGINT;
+ALTER TABLE minters ADD COLUMN IF NOT EXISTS tx_hash VARCHAR(66);
+
+-- Addresses used to be stored as entered and are now stored checksummed, so
+-- the same minter may be stored twice in different case. The row with the
+-- latest role change, or the newest one, is kept, along with any label.
+UPDATE minters m SET label = older.label
+FROM minters older
+WHERE lower(older.address) = lower(m.address) AND older.id <> m.id
+    AND m.label IS NULL AND older.label IS NOT NULL;
+
+DELETE FROM minters m USING minters newer
+WHERE lower(m.address) = lower(newer.address)
+    AND (COALESCE(m.block_number, -1), m.id) < (COALESCE(newer.block_number, -1), newer.id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS minters_address_lower_idx ON minters (lower(address));
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"erc-721-checks/internal/contract"
+	"erc-721-checks/internal/models"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	resultDone      = "done"
+	resultUnchanged = "unchanged"
+	resultPending   = "pending"
+	resultFailed    = "failed"
+	resultInvalid   = "invalid"
+	resultDuplicate = "duplicate"
+
+	activeStatus   = "active"
+	archivedStatus = "archived"
+)
+
+var bulkColumns = []string{"row", "address", "status", "label", "result", "txHash", "error"}
+
+// bulkRow is a row of a bulk file and of its report. Reports have the same
+// format as the input, so passing a report back in retries only the rows that
+// did not go through.
+type bulkRow struct {
+	Row     int    `json:"row"`
+	Address string `json:"address"`
+	Status  string `json:"status"`
+	Label   string `json:"label,omitempty"`
+	Result  string `json:"result,omitempty"`
+	TxHash  string `json:"txHash,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// priorMinter is the stored minter a row's transaction is restored to when it
+// fails.
+type priorMinter struct {
+	minter models.Minter
+	stored bool
+}
+
+func (r bulkRow) finished() bool {
+	return r.Result == resultDone || r.Result == resultUnchanged || r.Result == resultDuplicate
+}
+
+type bulkSummary struct {
+	Contract string         `json:"contract"`
+	File     string         `json:"file"`
+	Report   string         `json:"report"`
+	Rows     int            `json:"rows"`
+	Results  map[string]int `json:"results"`
+	Error    string         `json:"error,omitempty"`
+}
+
+func (s bulkSummary) String() string {
+	if s.Error != "" {
+		return fmt.Sprintf("failed: %s", s.Error)
+	}
+
+	var results []string
+	for result, count := range s.Results {
+		results = append(results, fmt.Sprintf("%d %s", count, result))
+	}
+	sort.Strings(results)
+	return fmt.Sprintf("%d rows: %s. Report written to %s", s.Rows, strings.Join(results, ", "), s.Report)
+}
+
+// bulkRoles grants and revokes MINTER_ROLE for every row of a CSV or JSON
+// file and writes a report next to it.
+func bulkRoles(args ...string) error {
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Println("Usage: bulkRoles <file> [report file]")
+		return nil
+	}
+
+	report := ""
+	if len(args) == 2 {
+		report = args[1]
+	}
+
+	ctx, done := shutdown.Begin()
+	defer done()
+
+	summary, _ := bulk(ctx, args[0], report)
+	fmt.Println(summary)
+	return nil
+}
+
+func bulkCommand(ctx context.Context, opts options) (fmt.Stringer, int) {
+	return bulk(ctx, opts.file, opts.report)
+}
+
+// bulk processes the file and writes the report, by default to the file name
+// with .report added before the extension. It returns the exit code for the
+// results.
+func bulk(ctx context.Context, file, report string) (bulkSummary, int) {
+	if report == "" {
+		report = reportPath(file)
+	}
+	summary := bulkSummary{Contract: smartContract.ContractAddress.Hex(), File: file, Report: report, Results: make(map[string]int)}
+
+	rows, err := readBulkFile(file)
+	if err != nil {
+		summary.Error = err.Error()
+		return summary, exitFailure
+	}
+
+	processBulk(ctx, rows)
+
+	if err := writeBulkFile(report, rows); err != nil {
+		summary.Error = err.Error()
+		return summary, exitFailure
+	}
+
+	summary.Rows = len(rows)
+	for _, row := range rows {
+		summary.Results[row.Result]++
+	}
+
+	switch {
+	case summary.Results[resultFailed] > 0 || summary.Results[resultInvalid] > 0:
+		return summary, exitFailure
+	case summary.Results[resultPending] > 0:
+		return summary, exitPending
+	default:
+		return summary, exitOK
+	}
+}
+
+// processBulk validates the rows that are not finished yet, stores them as
+// minters and sends a transaction for every row the chain does not match.
+// Transactions are sent one after another with consecutive nonces and then
+// waited for together. Rows left pending by an earlier run wait for their
+// transaction instead of sending another one.
+func processBulk(ctx context.Context, rows []bulkRow) {
+	var changes []int
+	seen := make(map[common.Address]int)
+	priors := make(map[int]priorMinter)
+	resumed := make(map[int]*types.Transaction)
+	for i := range rows {
+		row := &rows[i]
+		if row.finished() {
+			if row.Result != resultDuplicate && common.IsHexAddress(row.Address) {
+				seen[common.HexToAddress(row.Address)] = i
+			}
+			continue
+		}
+
+		if row.Result == resultPending && row.TxHash != "" && common.IsHexAddress(row.Address) {
+			tx, err := pendingTransaction(*row)
+			if err != nil {
+				// The row stays pending, as its transaction may still be mined.
+				row.Error = err.Error()
+				seen[common.HexToAddress(row.Address)] = i
+				continue
+			}
+			if tx != nil {
+				seen[common.HexToAddress(row.Address)] = i
+				resumed[i] = tx
+				continue
+			}
+		}
+
+		if !validateBulkRow(row, rows, seen) {
+			continue
+		}
+		seen[common.HexToAddress(row.Address)] = i
+
+		status := models.ActiveMinterStatus
+		if row.Status == archivedStatus {
+			status = models.ArchivedMinterStatus
+		}
+
+		hasRole, err := smartContract.Instance.HasRole(&bind.CallOpts{Context: ctx}, contract.MinterRoleHash, common.HexToAddress(row.Address))
+		if err != nil {
+			failBulkRow(row, fmt.Errorf("failed to check if minter has role: %v", err))
+			continue
+		}
+
+		prior, stored, err := minterRepository.GetMinter(row.Address)
+		if err != nil {
+			failBulkRow(row, err)
+			continue
+		}
+		if err := minterRepository.UpsertMinter(models.Minter{Address: row.Address, Status: status, Label: row.Label}); err != nil {
+			failBulkRow(row, err)
+			continue
+		}
+		priors[i] = priorMinter{minter: prior, stored: stored}
+
+		if hasRole == (status == models.ActiveMinterStatus) {
+			row.Result = resultUnchanged
+			continue
+		}
+		changes = append(changes, i)
+	}
+
+	var waitGroup sync.WaitGroup
+	for i, tx := range resumed {
+		fmt.Fprintf(smartContract.Log, "Waiting for %s of row %d (%s) with nonce %d: %s\n", bulkAction(rows[i]), rows[i].Row, rows[i].Address, tx.Nonce(), tx.Hash().Hex())
+		waitBulkRow(ctx, &waitGroup, &rows[i], tx, nil)
+	}
+
+	for _, i := range changes {
+		row := &rows[i]
+		if ctx.Err() != nil {
+			failBulkRow(row, fmt.Errorf("interrupted before sending: %w", ctx.Err()))
+			restoreMinter(*row, priors[i])
+			continue
+		}
+
+		tx, err := smartContract.SendRoleChange(ctx, bulkAction(*row), row.Address)
+		if err != nil {
+			failBulkRow(row, err)
+			restoreMinter(*row, priors[i])
+			continue
+		}
+		fmt.Fprintf(smartContract.Log, "Sent %s for row %d (%s) with nonce %d: %s\n", bulkAction(*row), row.Row, row.Address, tx.Nonce(), tx.Hash().Hex())
+		row.TxHash = tx.Hash().Hex()
+
+		prior := priors[i]
+		waitBulkRow(ctx, &waitGroup, row, tx, &prior)
+	}
+
+	waitGroup.Wait()
+}
+
+// pendingTransaction returns the stored transaction a pending row was sent
+// with, or nil when it never made it to the chain and the row can be sent
+// again.
+func pendingTransaction(row bulkRow) (*types.Transaction, error) {
+	record, tx, err := smartContract.Transactions.Transaction(row.TxHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up transaction %s: %v", row.TxHash, err)
+	}
+	if record.Status == models.DroppedTransactionStatus {
+		return nil, nil
+	}
+	return tx, nil
+}
+
+// waitBulkRow records the outcome of the row's transaction in the background.
+// A failed row is restored to prior, or left as stored when prior is nil
+// because an earlier run changed it.
+func waitBulkRow(ctx context.Context, waitGroup *sync.WaitGroup, row *bulkRow, tx *types.Transaction, prior *priorMinter) {
+	waitGroup.Add(1)
+	go func() {
+		defer waitGroup.Done()
+
+		receipt, err := smartContract.WaitTransaction(ctx, bulkAction(*row), tx)
+		switch {
+		case err == nil:
+			row.Result = resultDone
+			row.TxHash = receipt.TxHash.Hex()
+			row.Error = ""
+		case errors.Is(err, contract.ErrTransactionPending):
+			row.Result = resultPending
+			row.Error = err.Error()
+		default:
+			failBulkRow(row, err)
+			if prior != nil {
+				restoreMinter(*row, *prior)
+			}
+		}
+	}()
+}
+
+// validateBulkRow normalizes the row's address and status, and marks rows
+// that are invalid or repeat an earlier address.
+func validateBulkRow(row *bulkRow, rows []bulkRow, seen map[common.Address]int) bool {
+	row.Result, row.TxHash, row.Error = "", "", ""
+
+	if !common.IsHexAddress(strings.TrimSpace(row.Address)) {
+		row.Result = resultInvalid
+		row.Error = fmt.Sprintf("invalid address %q", row.Address)
+		return false
+	}
+	row.Address = common.HexToAddress(strings.TrimSpace(row.Address)).Hex()
+
+	switch strings.ToLower(strings.TrimSpace(row.Status)) {
+	case activeStatus, contract.GrantAction, "1":
+		row.Status = activeStatus
+	case archivedStatus, contract.RevokeAction, "0":
+		row.Status = archivedStatus
+	default:
+		row.Result = resultInvalid
+		row.Error = fmt.Sprintf("invalid status %q, expected %s or %s", row.Status, activeStatus, archivedStatus)
+		return false
+	}
+
+	if i, ok := seen[common.HexToAddress(row.Address)]; ok {
+		if rows[i].Status == row.Status {
+			row.Result = resultDuplicate
+			row.Error = fmt.Sprintf("duplicate of row %d", rows[i].Row)
+		} else {
+			row.Result = resultInvalid
+			row.Error = fmt.Sprintf("conflicts with row %d", rows[i].Row)
+		}
+		return false
+	}
+
+	return true
+}
+
+func bulkAction(row bulkRow) string {
+	if row.Status == archivedStatus {
+		return contract.RevokeAction
+	}
+	return contract.GrantAction
+}
+
+func failBulkRow(row *bulkRow, err error) {
+	row.Result = resultFailed
+	row.Error = err.Error()
+	fmt.Fprintf(smartContract.Log, "Row %d (%s) failed: %v\n", row.Row, row.Address, err)
+}
+
+// restoreMinter puts back the minter as it was stored before the row was
+// processed, deleting it when it was not stored.
+func restoreMinter(row bulkRow, prior priorMinter) {
+	var err error
+	if prior.stored {
+		err = minterRepository.RestoreMinter(prior.minter)
+	} else {
+		err = minterRepository.DeleteMinter(row.Address)
+	}
+	if err != nil {
+		fmt.Fprintf(smartContract.Log, "failed to restore minter %s: %v\n", row.Address, err)
+	}
+}
+
+// reportPath adds .report before the extension. Reports are written over
+// themselves when they are passed back in.
+func reportPath(file string) string {
+	extension := filepath.Ext(file)
+	base := strings.TrimSuffix(file, extension)
+	if strings.HasSuffix(base, ".report") {
+		return file
+	}
+	return base + ".report" + extension
+}
+
+func isJSONFile(file string) bool {
+	return strings.EqualFold(filepath.Ext(file), ".json")
+}
+
+// readBulkFile reads a JSON array of rows or a CSV file. CSV files may start
+// with a header naming the columns, otherwise the columns are address, status
+// and label.
+func readBulkFile(file string) ([]bulkRow, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", file, err)
+	}
+
+	if isJSONFile(file) {
+		var rows []bulkRow
+		if err := json.Unmarshal(content, &rows); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %v", file, err)
+		}
+		for i := range rows {
+			if rows[i].Row == 0 {
+				rows[i].Row = i + 1
+			}
+		}
+		return rows, nil
+	}
+
+	reader := csv.NewReader(strings.NewReader(string(content)))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", file, err)
+	}
+
+	columns := []string{"address", "status", "label"}
+	if len(records) > 0 {
+		for _, field := range records[0] {
+			if strings.EqualFold(strings.TrimSpace(field), "address") {
+				columns = records[0]
+				records = records[1:]
+				break
+			}
+		}
+	}
+
+	rows := make([]bulkRow, 0, len(records))
+	for i, record := range records {
+		row := bulkRow{Row: i + 1}
+		for j, field := range record {
+			if j >= len(columns) {
+				break
+			}
+			field = strings.TrimSpace(field)
+			switch strings.ToLower(strings.TrimSpace(columns[j])) {
+			case "row":
+				if number, err := strconv.Atoi(field); err == nil {
+					row.Row = number
+				}
+			case "address":
+				row.Address = field
+			case "status":
+				row.Status = field
+			case "label":
+				row.Label = field
+			case "result":
+				row.Result = field
+			case "txhash":
+				row.TxHash = field
+			case "error":
+				row.Error = field
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func writeBulkFile(file string, rows []bulkRow) error {
+	output, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("failed to create report %s: %v", file, err)
+	}
+	defer output.Close()
+
+	if isJSONFile(file) {
+		encoder := json.NewEncoder(output)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(rows); err != nil {
+			return fmt.Errorf("failed to write report %s: %v", file, err)
+		}
+		return nil
+	}
+
+	writer := csv.NewWriter(output)
+	writer.Write(bulkColumns)
+	for _, row := range rows {
+		writer.Write([]string{strconv.Itoa(row.Row), row.Address, row.Status, row.Label, row.Result, row.TxHash, row.Error})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write report %s: %v", file, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"erc-721-checks/internal/contract"
+	"erc-721-checks/internal/utils"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+	// exitPending means a transaction was sent but not mined before the
+	// command stopped. It may still be mined.
+	exitPending = 3
+
+	outputText = "text"
+	outputJSON = "json"
+
+	statusMined   = "mined"
+	statusPending = "pending"
+	statusFailed  = "failed"
+)
+
+// command is a non-interactive subcommand. run returns the result written to
+// stdout and the exit code.
+type command struct {
+	name        string
+	description string
+	needsMinter bool
+	needsFile   bool
+	// savesPlan takes an optional --plan file, readsPlan a required one.
+	savesPlan bool
+	readsPlan bool
+	// needsNonce takes a required --nonce.
+	needsNonce bool
+	run        func(ctx context.Context, opts options) (fmt.Stringer, int)
+}
+
+// options are the command specific flags.
+type options struct {
+	minter string
+	file   string
+	report string
+	plan   string
+	nonce  uint64
+}
+
+var commands = []command{
+	{name: "grant-role", description: "Grant MINTER_ROLE to --address", needsMinter: true, run: func(ctx context.Context, opts options) (fmt.Stringer, int) {
+		return roleCommand(ctx, contract.GrantAction, grant, opts.minter)
+	}},
+	{name: "revoke-role", description: "Revoke MINTER_ROLE from --address", needsMinter: true, run: func(ctx context.Context, opts options) (fmt.Stringer, int) {
+		return roleCommand(ctx, contract.RevokeAction, revoke, opts.minter)
+	}},
+	{name: "bulk-roles", description: "Grant and revoke MINTER_ROLE for every row of the CSV or JSON --file", needsFile: true, run: bulkCommand},
+	{name: "list-minters", description: "List the accounts with MINTER_ROLE on chain", run: listMintersCommand},
+	{name: "sync-minters", description: "Grant and revoke MINTER_ROLE until the chain matches the database", run: syncMintersCommand},
+	{name: "plan-sync", description: "Print the transactions sync-minters would send with their estimated cost, saving them to --plan", savesPlan: true, run: planSyncCommand},
+	{name: "apply-plan", description: "Send exactly the transactions of the --plan saved by plan-sync", readsPlan: true, run: applyPlanCommand},
+	{name: "stuck-transactions", description: "List the transactions pending for longer than ADMIN_STUCK_AFTER", run: stuckTransactionsCommand},
+	{name: "bump-stuck", description: "Send the stuck transactions again with bumped fees and the same nonce", run: bumpStuckCommand},
+	{name: "cancel-nonce", description: "Replace the transaction pending with --nonce by a zero-value transfer to the signer", needsNonce: true, run: cancelNonceCommand},
+	{name: "fetch-minters", description: "Replace the minters in the database with the ones on chain", run: fetchMintersCommand},
+}
+
+// runCommand runs a subcommand without prompting and returns the exit code.
+// Only the result is written to stdout, progress goes to stderr.
+func runCommand(ctx context.Context, name string, args []string) int {
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage(os.Stdout)
+		return exitOK
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == name {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		printUsage(os.Stderr)
+		return exitUsage
+	}
+
+	flags := flag.NewFlagSet("admin "+name, flag.ContinueOnError)
+	contractAddress := flags.String("contract", "", "Checks contract `address`")
+	output := flags.String("output", outputText, "output `format`, text or json")
+	minter, file, report := new(string), new(string), new(string)
+	if cmd.needsMinter {
+		minter = flags.String("address", "", "minter `address`")
+	}
+	if cmd.needsFile {
+		file = flags.String("file", "", "CSV or JSON `file` with address, status and label columns")
+		report = flags.String("report", "", "report `file`, by default the file name with .report added")
+	}
+	plan := new(string)
+	if cmd.savesPlan || cmd.readsPlan {
+		plan = flags.String("plan", "", "plan `file`")
+	}
+	nonce := new(string)
+	if cmd.needsNonce {
+		nonce = flags.String("nonce", "", "signer `nonce`")
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	var problems []string
+	if flags.NArg() > 0 {
+		problems = append(problems, fmt.Sprintf("unexpected arguments %s", strings.Join(flags.Args(), " ")))
+	}
+	if !common.IsHexAddress(*contractAddress) {
+		problems = append(problems, "--contract has to be a valid address")
+	}
+	if cmd.needsMinter && !common.IsHexAddress(*minter) {
+		problems = append(problems, "--address has to be a valid address")
+	}
+	if cmd.needsFile && *file == "" {
+		problems = append(problems, "--file is required")
+	}
+	if cmd.readsPlan && *plan == "" {
+		problems = append(problems, "--plan is required")
+	}
+	nonceValue, err := strconv.ParseUint(*nonce, 10, 64)
+	if cmd.needsNonce && err != nil {
+		problems = append(problems, "--nonce has to be a number")
+	}
+	if *output != outputText && *output != outputJSON {
+		problems = append(problems, "--output has to be text or json")
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "%s\n", strings.Join(problems, "\n"))
+		flags.Usage()
+		return exitUsage
+	}
+
+	// Progress goes to stderr, so stdout only holds the result.
+	smartContract, err = contract.InitContract(common.HexToAddress(*contractAddress), transactionRepository, os.Stderr)
+	if err != nil {
+		err = fmt.Errorf("failed to initialize the smart contract: %v", err)
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		if err := writeResult(os.Stdout, *output, failureResult{Status: statusFailed, Error: err.Error()}); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+		return exitFailure
+	}
+
+	result, code := cmd.run(ctx, options{minter: common.HexToAddress(*minter).Hex(), file: *file, report: *report, plan: *plan, nonce: nonceValue})
+	if err := writeResult(os.Stdout, *output, result); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return exitFailure
+	}
+
+	return code
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: admin [command] [flags]")
+	fmt.Fprintln(w, "\nWithout a command the interactive menu starts.\n\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-18s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintf(w, "  %-18s %s\n", "daemon", "Keep syncing minters every ADMIN_SYNC_INTERVAL until stopped")
+	fmt.Fprintln(w, "\nEvery command takes --contract <address> and --output text|json.")
+	fmt.Fprintf(w, "Exit codes: %d success, %d failure, %d usage error, %d transaction still pending.\n",
+		exitOK, exitFailure, exitUsage, exitPending)
+}
+
+// failureResult is written when a command fails before it runs.
+type failureResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+}
+
+func (r failureResult) String() string {
+	return fmt.Sprintf("failed: %s", r.Error)
+}
+
+func writeResult(w io.Writer, output string, result fmt.Stringer) error {
+	if output == outputJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			return fmt.Errorf("failed to encode result: %v", err)
+		}
+		return nil
+	}
+
+	_, err := fmt.Fprintln(w, result.String())
+	return err
+}
+
+// daemonContract reads the daemon's --contract flag, prompting for the
+// address when it is missing.
+func daemonContract(args []string) string {
+	flags := flag.NewFlagSet("admin daemon", flag.ExitOnError)
+	contractAddress := flags.String("contract", "", "Checks contract `address`")
+	flags.Parse(args)
+
+	if *contractAddress == "" {
+		address, err := utils.PromptContractAddress()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return address
+	}
+	if !common.IsHexAddress(*contractAddress) {
+		fmt.Fprintln(os.Stderr, "--contract has to be a valid address")
+		os.Exit(exitUsage)
+	}
+
+	return *contractAddress
+}
+
+type roleResult struct {
+	Action   string `json:"action"`
+	Contract string `json:"contract"`
+	Address  string `json:"address"`
+	Status   string `json:"status"`
+	TxHash   string `json:"txHash,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (r roleResult) String() string {
+	switch r.Status {
+	case statusMined:
+		return fmt.Sprintf("%s %s: mined in %s", r.Action, r.Address, r.TxHash)
+	case statusPending:
+		return fmt.Sprintf("%s %s: still pending in %s", r.Action, r.Address, r.TxHash)
+	default:
+		return fmt.Sprintf("%s %s: failed: %s", r.Action, r.Address, r.Error)
+	}
+}
+
+func roleCommand(ctx context.Context, action string, send func(context.Context, string) (common.Hash, error), minter string) (fmt.Stringer, int) {
+	result := roleResult{Action: action, Contract: smartContract.ContractAddress.Hex(), Address: minter}
+
+	txHash, err := send(ctx, minter)
+	if txHash != (common.Hash{}) {
+		result.TxHash = txHash.Hex()
+	}
+
+	switch {
+	case err == nil:
+		result.Status = statusMined
+		return result, exitOK
+	case errors.Is(err, contract.ErrTransactionPending):
+		result.Status = statusPending
+		result.Error = err.Error()
+		return result, exitPending
+	default:
+		result.Status = statusFailed
+		result.Error = err.Error()
+		return result, exitFailure
+	}
+}
+
+type mintersResult struct {
+	Contract string   `json:"contract"`
+	Minters  []string `json:"minters"`
+	Error    string   `json:"error,omitempty"`
+}
+
+func (r mintersResult) String() string {
+	if r.Error != "" {
+		return r.Error
+	}
+	return strings.Join(r.Minters, "\n")
+}
+
+func listMintersCommand(ctx context.Context, _ options) (fmt.Stringer, int) {
+	result := mintersResult{Contract: smartContract.ContractAddress.Hex(), Minters: []string{}}
+
+	minters, err := smartContract.GetMinters(ctx)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to get minters: %v", err)
+		return result, exitFailure
+	}
+
+	for _, minter := range minters {
+		result.Minters = append(result.Minters, minter.Address)
+	}
+	return result, exitOK
+}
+
+type syncResult struct {
+	Contract string `json:"contract"`
+	Status   string `json:"status"`
+	Minters  *int   `json:"minters,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (r syncResult) String() string {
+	if r.Status == statusPending {
+		return fmt.Sprintf("still pending: %s", r.Error)
+	}
+	if r.Error != "" {
+		return fmt.Sprintf("failed: %s", r.Error)
+	}
+	if r.Minters != nil {
+		return fmt.Sprintf("%d minters saved to the database", *r.Minters)
+	}
+	return "sync completed"
+}
+
+func syncMintersCommand(ctx context.Context, _ options) (fmt.Stringer, int) {
+	result := syncResult{Contract: smartContract.ContractAddress.Hex(), Status: "completed"}
+
+	err := runSync(ctx)
+	switch {
+	case err == nil:
+		return result, exitOK
+	case errors.Is(err, contract.ErrTransactionPending):
+		result.Status = statusPending
+		result.Error = err.Error()
+		return result, exitPending
+	default:
+		result.Status = statusFailed
+		result.Error = err.Error()
+		return result, exitFailure
+	}
+}
+
+func fetchMintersCommand(ctx context.Context, _ options) (fmt.Stringer, int) {
+	result := syncResult{Contract: smartContract.ContractAddress.Hex(), Status: "completed"}
+	count, err := fetch(ctx)
+	if err != nil {
+		result.Status = statusFailed
+		result.Error = err.Error()
+		return result, exitFailure
+	}
+	result.Minters = &count
+	return result, exitOK
+}
@@ -2,83 +2,115 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"time"
 
 	"erc-721-checks/internal/contract"
 	"erc-721-checks/internal/database"
+	"erc-721-checks/internal/metrics"
 	"erc-721-checks/internal/models"
 	"erc-721-checks/internal/utils"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/turret-io/go-menu/menu"
 )
 
-const mintersBatchSize = 50
+const (
+	mintersBatchSize    = 50
+	defaultSyncInterval = time.Minute
+	defaultPlanMaxAge   = time.Hour
+)
 
 var (
 	smartContract    *contract.SmartContract
 	minterRepository *models.MinterRepository
+	// transactionRepository stores the transactions sent by the contract's
+	// transaction manager.
+	transactionRepository *models.TransactionRepository
+	shutdown              *utils.Shutdown
 )
 
 func init() {
-	var err error
-	if err = database.InitDB(); err != nil {
+	if err := database.InitDB(); err != nil {
 		log.Fatalf("Failed to initialize the database connection pool: %v", err)
 	}
 	minterRepository = models.NewMinterRepository(database.DBInstance)
+	transactionRepository = models.NewTransactionRepository(database.DBInstance)
+}
 
-	smartContract, err = contract.InitContract()
+func initContract(address string) {
+	var err error
+	smartContract, err = contract.InitContract(common.HexToAddress(address), transactionRepository, os.Stdout)
 	if err != nil {
 		log.Fatalf("Failed to initialize the smart contract: %v", err)
 	}
 }
 
-func grantRole(address string) error {
+// grant adds the minter to the database and grants it MINTER_ROLE. The
+// minter is archived again when the grant fails, but kept while it may still
+// be mined.
+func grant(ctx context.Context, address string) (common.Hash, error) {
+	address = common.HexToAddress(address).Hex()
 	if err := minterRepository.CreateMinter(address, models.ActiveMinterStatus); err != nil {
-		fmt.Printf("failed to add minter to the database: %v\n", err)
-		return nil
+		return common.Hash{}, fmt.Errorf("failed to add minter to the database: %v", err)
 	}
 
-	currentNonce, err := smartContract.ContractClient.PendingNonceAt(context.Background(), smartContract.Auth.From)
-	if err != nil {
-		return fmt.Errorf("failed to retrieve account nonce: %v", err)
-	}
-
-	if err := smartContract.GrantRole(address, currentNonce); err != nil {
-		fmt.Printf("failed to grant role: %v\n", err)
-
+	txHash, err := smartContract.GrantRole(ctx, address)
+	if err != nil && !errors.Is(err, contract.ErrTransactionPending) {
 		if err := minterRepository.UpdateMinter(address, models.ArchivedMinterStatus); err != nil {
-			fmt.Printf("failed to delete minter: %v\n", err)
+			fmt.Fprintf(smartContract.Log, "failed to delete minter: %v\n", err)
 		}
 	}
 
-	return nil
+	return txHash, err
 }
 
-func revokeRole(address string) error {
+// revoke archives the minter and revokes its MINTER_ROLE, restoring the
+// minter when the revoke fails.
+func revoke(ctx context.Context, address string) (common.Hash, error) {
+	address = common.HexToAddress(address).Hex()
 	if err := minterRepository.UpdateMinter(address, models.ArchivedMinterStatus); err != nil {
-		fmt.Printf("failed to remove minter from the database: %v\n", err)
-		return nil
+		return common.Hash{}, fmt.Errorf("failed to remove minter from the database: %v", err)
 	}
 
-	currentNonce, err := smartContract.ContractClient.PendingNonceAt(context.Background(), smartContract.Auth.From)
-	if err != nil {
-		return fmt.Errorf("failed to retrieve account nonce: %v", err)
+	txHash, err := smartContract.RevokeRole(ctx, address)
+	if err != nil && !errors.Is(err, contract.ErrTransactionPending) {
+		if err := minterRepository.UpdateMinter(address, models.ActiveMinterStatus); err != nil {
+			fmt.Fprintf(smartContract.Log, "failed to create minter: %v\n", err)
+		}
 	}
 
-	if err := smartContract.RevokeRole(address, currentNonce); err != nil {
-		fmt.Printf("failed to revoke role: %v\n", err)
+	return txHash, err
+}
 
-		if err := minterRepository.UpdateMinter(address, models.ActiveMinterStatus); err != nil {
-			fmt.Printf("failed to create minter: %v\n", err)
-		}
+func grantRole(address string) error {
+	ctx, done := shutdown.Begin()
+	defer done()
+
+	if _, err := grant(ctx, address); err != nil {
+		fmt.Printf("failed to grant role: %v\n", err)
 	}
+	return nil
+}
+
+func revokeRole(address string) error {
+	ctx, done := shutdown.Begin()
+	defer done()
 
+	if _, err := revoke(ctx, address); err != nil {
+		fmt.Printf("failed to revoke role: %v\n", err)
+	}
 	return nil
 }
 
 func printMinters(args ...string) error {
-	minters, err := smartContract.GetMinters()
+	ctx, done := shutdown.Begin()
+	defer done()
+
+	minters, err := smartContract.GetMinters(ctx)
 	if err != nil {
 		fmt.Printf("failed to get minters: %v\n", err)
 		return nil
@@ -92,31 +124,91 @@ func printMinters(args ...string) error {
 }
 
 func syncMinters(args ...string) error {
+	ctx, done := shutdown.Begin()
+	defer done()
+
+	printSync(runSync(ctx))
+	return nil
+}
+
+func runSync(ctx context.Context) error {
 	minters, err := minterRepository.GetAllMinters()
 	if err != nil {
-		fmt.Printf("failed to fetch existing minters from database: %v\n", err)
-		return nil
+		return fmt.Errorf("failed to fetch existing minters from database: %v", err)
+	}
+
+	syncErr := smartContract.SyncMinterRoles(ctx, minters, mintersBatchSize)
+	if err := smartContract.UpdateSignerBalance(ctx); err != nil {
+		fmt.Fprintf(smartContract.Log, "%v\n", err)
 	}
 
-	err = smartContract.SyncMinterRoles(minters, mintersBatchSize)
+	return syncErr
+}
+
+func printSync(err error) {
 	if err != nil {
 		fmt.Printf("\nSync failed with error: %v\n", err)
 	} else {
 		fmt.Println("\nSync completed")
 	}
+}
+
+// syncDaemon runs syncMinters every ADMIN_SYNC_INTERVAL until shutdown, bumping
+// stuck transactions first, and serves metrics when METRICS_ADDRESS is set.
+func syncDaemon(args ...string) error {
+	ctx, done := shutdown.Begin()
+	defer done()
 
+	if err := daemon(ctx); err != nil {
+		fmt.Printf("%v\n", err)
+	}
 	return nil
 }
 
-func fetchMinters(args ...string) error {
-	mintersArray, err := smartContract.GetMinters()
+// daemon syncs the minters every ADMIN_SYNC_INTERVAL until ctx is cancelled.
+func daemon(ctx context.Context) error {
+	interval, err := utils.EnvDurationHelper(utils.AdminSyncInterval, defaultSyncInterval)
 	if err != nil {
-		fmt.Printf("failed to get minters: %v\n", err)
-		return nil
+		return err
 	}
 
-	if err := minterRepository.InitializeMintersTable(mintersArray); err != nil {
-		fmt.Printf("failed to initialize minters table: %v\n", err)
+	if address := utils.EnvHelper(utils.MetricsAddress); address != "" {
+		go func() {
+			if err := utils.Serve(ctx, address, metrics.Handler()); err != nil {
+				fmt.Printf("%v\n", err)
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	fmt.Printf("Syncing minters every %s\n", interval)
+	for {
+		// Transactions left pending by earlier runs would hold back every
+		// later nonce.
+		if stuck, err := smartContract.Transactions.BumpStuck(ctx); err != nil {
+			fmt.Printf("%v\n", err)
+		} else if len(stuck) > 0 {
+			fmt.Println(stuckResult{Transactions: stuck})
+		}
+
+		printSync(runSync(ctx))
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func fetchMinters(args ...string) error {
+	ctx, done := shutdown.Begin()
+	defer done()
+
+	if _, err := fetch(ctx); err != nil {
+		fmt.Printf("%v\n", err)
 		return nil
 	}
 
@@ -124,13 +216,67 @@ func fetchMinters(args ...string) error {
 	return nil
 }
 
+// fetch replaces the minters table with the minters on chain.
+func fetch(ctx context.Context) (int, error) {
+	mintersArray, err := smartContract.GetMinters(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get minters: %v", err)
+	}
+
+	if err := minterRepository.InitializeMintersTable(mintersArray); err != nil {
+		return 0, fmt.Errorf("failed to initialize minters table: %v", err)
+	}
+
+	return len(mintersArray), nil
+}
+
 func main() {
+	shutdown = utils.HandleShutdown(func() {
+		if smartContract != nil {
+			smartContract.ContractClient.Close()
+		}
+		database.DBInstance.Close()
+	})
+
+	if len(os.Args) > 1 && os.Args[1] == "daemon" {
+		initContract(daemonContract(os.Args[2:]))
+
+		// As for commands, the shutdown stays blocked until the daemon
+		// returned and exits with its code.
+		ctx, _ := shutdown.Begin()
+		if err := daemon(ctx); err != nil {
+			fmt.Printf("%v\n", err)
+			shutdown.Exit(exitFailure)
+		}
+		shutdown.Exit(exitOK)
+	}
+
+	if len(os.Args) > 1 {
+		// The shutdown stays blocked until the command exits, so a signal
+		// cannot replace its exit code.
+		ctx, _ := shutdown.Begin()
+		shutdown.Exit(runCommand(ctx, os.Args[1], os.Args[2:]))
+	}
+
+	address, err := utils.PromptContractAddress()
+	if err != nil {
+		log.Fatal(err)
+	}
+	initContract(address)
+
 	commandOptions := []menu.CommandOption{
 		{Command: "grantRole", Description: "Grant user minter role", Function: utils.PromptAddress(grantRole)},
 		{Command: "revokeRole", Description: "Revoke user minter role", Function: utils.PromptAddress(revokeRole)},
 		{Command: "printMinters", Description: "Get all users with minter role", Function: printMinters},
+		{Command: "bulkRoles", Description: "Grant and revoke minter roles from a CSV or JSON file", Function: bulkRoles},
 		{Command: "syncMinters", Description: "Sync local minters with contract", Function: syncMinters},
+		{Command: "planSync", Description: "Review the transactions syncMinters would send before sending them, or save them to a file", Function: planSync},
+		{Command: "applyPlan", Description: "Send the transactions of a plan saved by planSync", Function: applyPlan},
+		{Command: "stuckTransactions", Description: "List transactions pending for longer than ADMIN_STUCK_AFTER", Function: stuckTransactions},
+		{Command: "bumpStuck", Description: "Send stuck transactions again with bumped fees", Function: bumpStuck},
+		{Command: "cancelNonce", Description: "Cancel the transaction pending with a nonce", Function: cancelNonce},
 		{Command: "fetchMinters", Description: "Save all users with minter role to local db", Function: fetchMinters},
+		{Command: "syncDaemon", Description: "Keep syncing local minters with contract until stopped", Function: syncDaemon},
 	}
 	menuOptions := menu.NewMenuOptions("\n> ", 0)
 	menu := menu.NewMenu(commandOptions, menuOptions)
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"erc-721-checks/internal/contract"
+	"erc-721-checks/internal/utils"
+)
+
+// planSync prints what syncMinters would send and applies it once approved.
+// With a file the plan is saved instead, to be applied with applyPlan.
+func planSync(args ...string) error {
+	if len(args) > 1 {
+		fmt.Println("Usage: planSync [plan file]")
+		return nil
+	}
+
+	ctx, done := shutdown.Begin()
+	defer done()
+
+	plan, err := makePlan(ctx)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return nil
+	}
+	fmt.Printf("\n%s\n", plan)
+
+	if len(args) == 1 {
+		if err := savePlan(args[0], plan); err != nil {
+			fmt.Printf("%v\n", err)
+			return nil
+		}
+		fmt.Printf("Plan saved to %s, apply it with applyPlan %s\n", args[0], args[0])
+		return nil
+	}
+
+	confirmAndApply(ctx, plan)
+	return nil
+}
+
+// applyPlan applies a plan saved by planSync once approved.
+func applyPlan(args ...string) error {
+	if len(args) != 1 {
+		fmt.Println("Usage: applyPlan <plan file>")
+		return nil
+	}
+
+	ctx, done := shutdown.Begin()
+	defer done()
+
+	plan, err := loadPlan(args[0])
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return nil
+	}
+	fmt.Printf("\n%s\n", plan)
+
+	confirmAndApply(ctx, plan)
+	return nil
+}
+
+func confirmAndApply(ctx context.Context, plan contract.Plan) {
+	if len(plan.Changes) == 0 {
+		fmt.Println("\nNothing to sync")
+		return
+	}
+
+	approved, err := utils.PromptConfirm(fmt.Sprintf("Send %d transactions?", len(plan.Changes)))
+	if err != nil || !approved {
+		fmt.Println("Plan not applied")
+		return
+	}
+
+	printSync(runPlan(ctx, plan))
+}
+
+// makePlan plans a sync of the minters in the database.
+func makePlan(ctx context.Context) (contract.Plan, error) {
+	minters, err := minterRepository.GetAllMinters()
+	if err != nil {
+		return contract.Plan{}, fmt.Errorf("failed to fetch existing minters from database: %v", err)
+	}
+
+	return smartContract.PlanMinterRoles(ctx, minters)
+}
+
+func runPlan(ctx context.Context, plan contract.Plan) error {
+	maxAge, err := utils.EnvDurationHelper(utils.AdminPlanMaxAge, defaultPlanMaxAge)
+	if err != nil {
+		return err
+	}
+
+	applyErr := smartContract.ApplyPlan(ctx, plan, mintersBatchSize, maxAge)
+	if err := smartContract.UpdateSignerBalance(ctx); err != nil {
+		fmt.Fprintf(smartContract.Log, "%v\n", err)
+	}
+
+	return applyErr
+}
+
+func savePlan(file string, plan contract.Plan) error {
+	content, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode plan: %v", err)
+	}
+
+	if err := os.WriteFile(file, append(content, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to save plan: %v", err)
+	}
+	return nil
+}
+
+func loadPlan(file string) (contract.Plan, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return contract.Plan{}, fmt.Errorf("failed to read plan: %v", err)
+	}
+
+	var plan contract.Plan
+	if err := json.Unmarshal(content, &plan); err != nil {
+		return contract.Plan{}, fmt.Errorf("failed to decode plan %s: %v", file, err)
+	}
+	return plan, nil
+}
+
+type planResult struct {
+	contract.Plan
+	File  string `json:"file,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+func (r planResult) String() string {
+	if r.Error != "" {
+		return fmt.Sprintf("failed: %s", r.Error)
+	}
+	if r.File != "" {
+		return fmt.Sprintf("%s\nPlan saved to %s", r.Plan, r.File)
+	}
+	return r.Plan.String()
+}
+
+func planSyncCommand(ctx context.Context, opts options) (fmt.Stringer, int) {
+	plan, err := makePlan(ctx)
+	if err != nil {
+		return planResult{Error: err.Error()}, exitFailure
+	}
+
+	result := planResult{Plan: plan, File: opts.plan}
+	if opts.plan != "" {
+		if err := savePlan(opts.plan, plan); err != nil {
+			result.Error = err.Error()
+			return result, exitFailure
+		}
+	}
+	return result, exitOK
+}
+
+func applyPlanCommand(ctx context.Context, opts options) (fmt.Stringer, int) {
+	result := syncResult{Contract: smartContract.ContractAddress.Hex(), Status: "completed"}
+
+	plan, err := loadPlan(opts.plan)
+	if err == nil {
+		err = runPlan(ctx, plan)
+	}
+
+	switch {
+	case err == nil:
+		return result, exitOK
+	case errors.Is(err, contract.ErrTransactionPending):
+		result.Status = statusPending
+		result.Error = err.Error()
+		return result, exitPending
+	default:
+		result.Status = statusFailed
+		result.Error = err.Error()
+		return result, exitFailure
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"erc-721-checks/internal/contract"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// stuckTransactions prints the transactions pending for longer than
+// ADMIN_STUCK_AFTER.
+func stuckTransactions(args ...string) error {
+	ctx, done := shutdown.Begin()
+	defer done()
+
+	stuck, err := smartContract.Transactions.Stuck(ctx)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return nil
+	}
+
+	fmt.Println(stuckResult{Transactions: stuck})
+	return nil
+}
+
+// bumpStuck sends the stuck transactions again with bumped fees.
+func bumpStuck(args ...string) error {
+	ctx, done := shutdown.Begin()
+	defer done()
+
+	stuck, err := smartContract.Transactions.BumpStuck(ctx)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return nil
+	}
+
+	fmt.Println(stuckResult{Transactions: stuck})
+	return nil
+}
+
+func cancelNonce(args ...string) error {
+	if len(args) != 1 {
+		fmt.Println("Usage: cancelNonce <nonce>")
+		return nil
+	}
+
+	nonce, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		fmt.Printf("invalid nonce %q\n", args[0])
+		return nil
+	}
+
+	ctx, done := shutdown.Begin()
+	defer done()
+
+	if _, err := smartContract.CancelNonce(ctx, nonce); err != nil {
+		fmt.Printf("%v\n", err)
+	}
+	return nil
+}
+
+type stuckResult struct {
+	Contract     string                      `json:"contract"`
+	Transactions []contract.StuckTransaction `json:"transactions"`
+	Error        string                      `json:"error,omitempty"`
+}
+
+func (r stuckResult) String() string {
+	if r.Error != "" {
+		return fmt.Sprintf("failed: %s", r.Error)
+	}
+	if len(r.Transactions) == 0 {
+		return "No stuck transactions"
+	}
+
+	lines := make([]string, 0, len(r.Transactions))
+	for _, tx := range r.Transactions {
+		line := fmt.Sprintf("nonce %d: %s %s pending for %s in %s", tx.Nonce, tx.Action, tx.Target, tx.PendingFor, tx.Hash)
+		switch {
+		case tx.Error != "":
+			line += fmt.Sprintf(", not replaced: %s", tx.Error)
+		case tx.Replacement != "":
+			line += fmt.Sprintf(", replaced by %s", tx.Replacement)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func stuckTransactionsCommand(ctx context.Context, _ options) (fmt.Stringer, int) {
+	result := stuckResult{Contract: smartContract.ContractAddress.Hex()}
+
+	stuck, err := smartContract.Transactions.Stuck(ctx)
+	if err != nil {
+		result.Error = err.Error()
+		return result, exitFailure
+	}
+
+	result.Transactions = stuck
+	if len(stuck) > 0 {
+		return result, exitPending
+	}
+	return result, exitOK
+}
+
+func bumpStuckCommand(ctx context.Context, _ options) (fmt.Stringer, int) {
+	result := stuckResult{Contract: smartContract.ContractAddress.Hex()}
+
+	stuck, err := smartContract.Transactions.BumpStuck(ctx)
+	if err != nil {
+		result.Error = err.Error()
+		return result, exitFailure
+	}
+
+	result.Transactions = stuck
+	for _, tx := range stuck {
+		if tx.Error != "" {
+			return result, exitFailure
+		}
+	}
+	if len(stuck) > 0 {
+		return result, exitPending
+	}
+	return result, exitOK
+}
+
+type cancelResult struct {
+	Contract string `json:"contract"`
+	Nonce    uint64 `json:"nonce"`
+	Status   string `json:"status"`
+	TxHash   string `json:"txHash,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (r cancelResult) String() string {
+	switch r.Status {
+	case statusMined:
+		return fmt.Sprintf("cancel nonce %d: mined in %s", r.Nonce, r.TxHash)
+	case statusPending:
+		return fmt.Sprintf("cancel nonce %d: still pending in %s", r.Nonce, r.TxHash)
+	default:
+		return fmt.Sprintf("cancel nonce %d: failed: %s", r.Nonce, r.Error)
+	}
+}
+
+func cancelNonceCommand(ctx context.Context, opts options) (fmt.Stringer, int) {
+	result := cancelResult{Contract: smartContract.ContractAddress.Hex(), Nonce: opts.nonce}
+
+	txHash, err := smartContract.CancelNonce(ctx, opts.nonce)
+	if txHash != (common.Hash{}) {
+		result.TxHash = txHash.Hex()
+	}
+
+	switch {
+	case err == nil:
+		result.Status = statusMined
+		return result, exitOK
+	case errors.Is(err, contract.ErrTransactionPending):
+		result.Status = statusPending
+		result.Error = err.Error()
+		return result, exitPending
+	default:
+		result.Status = statusFailed
+		result.Error = err.Error()
+		return result, exitFailure
+	}
+}
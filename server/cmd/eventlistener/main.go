@@ -5,94 +5,651 @@ import (
 	"fmt"
 	"log"
 	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"erc-721-checks/internal/checks"
 	"erc-721-checks/internal/contract"
+	"erc-721-checks/internal/database"
+	"erc-721-checks/internal/feed"
+	"erc-721-checks/internal/health"
+	"erc-721-checks/internal/ipfs"
+	"erc-721-checks/internal/listener"
+	"erc-721-checks/internal/metrics"
+	"erc-721-checks/internal/models"
+	"erc-721-checks/internal/utils"
+	"erc-721-checks/internal/webhook"
 
-	"github.com/ethereum/go-ethereum"
-	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/turret-io/go-menu/menu"
 )
 
-type Transfer struct {
-	TxHash      common.Hash
-	BlockNumber uint64
-	BlockHash   common.Hash
-	From        common.Address
-	To          common.Address
-	TokenId     *big.Int
-}
+const (
+	defaultConfirmations = 12
+	defaultMaxHeadAge    = 2 * time.Minute
+	defaultMaxLag        = 20
+	// stallTimeout is comfortably above the listener's longest quiet period,
+	// the maximum reconnect delay.
+	stallTimeout = 5 * time.Minute
+	// A leader that failed to start resigns and campaigns again after a delay
+	// growing up to maxLeadRetryDelay.
+	minLeadRetryDelay = time.Second
+	maxLeadRetryDelay = 2 * time.Minute
+)
 
 var (
-	contractAbi   abi.ABI
-	smartContract *contract.SmartContract
-	logs          chan types.Log
+	eventRepository      *models.EventRepository
+	transferRepository   *models.TransferRepository
+	minterRepository     *models.MinterRepository
+	tokenRepository      *models.TokenRepository
+	metadataRepository   *models.TokenMetadataRepository
+	checkpointRepository *models.CheckpointRepository
+	webhookRepository    *models.WebhookDeliveryRepository
+	shutdown             *utils.Shutdown
 )
 
-func processEvents() {
-	for vLog := range logs {
-		var transferEvent Transfer
-		if err := contractAbi.UnpackIntoInterface(&transferEvent, "Transfer", vLog.Data); err != nil {
-			log.Fatal(err)
+func init() {
+	if err := database.InitDB(); err != nil {
+		log.Fatalf("Failed to initialize the database connection pool: %v", err)
+	}
+	eventRepository = models.NewEventRepository(database.DBInstance)
+	transferRepository = models.NewTransferRepository(database.DBInstance)
+	minterRepository = models.NewMinterRepository(database.DBInstance)
+	tokenRepository = models.NewTokenRepository(database.DBInstance)
+	metadataRepository = models.NewTokenMetadataRepository(database.DBInstance)
+	checkpointRepository = models.NewCheckpointRepository(database.DBInstance)
+	webhookRepository = models.NewWebhookDeliveryRepository(database.DBInstance)
+}
+
+// loadContracts parses LISTENER_CONTRACTS, a comma separated list of
+// label=address@startBlock entries where the label and start block are
+// optional. Without it the contract address is prompted for and
+// LISTENER_START_BLOCK applies.
+func loadContracts() ([]listener.Contract, error) {
+	entries := utils.EnvListHelper(utils.ListenerContracts)
+	if len(entries) == 0 {
+		address, err := utils.PromptContractAddress()
+		if err != nil {
+			return nil, err
+		}
+
+		c := listener.Contract{Address: common.HexToAddress(address)}
+		if utils.EnvHelper(utils.ListenerStartBlock) != "" {
+			startBlock, err := utils.EnvUintHelper(utils.ListenerStartBlock, 0)
+			if err != nil {
+				return nil, err
+			}
+			c.StartBlock = &startBlock
+		}
+
+		return []listener.Contract{c}, nil
+	}
+
+	var contracts []listener.Contract
+	for _, entry := range entries {
+		var c listener.Contract
+
+		address := entry
+		if label, rest, ok := strings.Cut(address, "="); ok {
+			c.Label, address = strings.TrimSpace(label), rest
 		}
 
-		transferEvent.TxHash = vLog.TxHash
-		transferEvent.BlockNumber = vLog.BlockNumber
-		transferEvent.BlockHash = vLog.BlockHash
-		transferEvent.From = common.HexToAddress(vLog.Topics[1].Hex())
-		transferEvent.To = common.HexToAddress(vLog.Topics[2].Hex())
-		transferEvent.TokenId = new(big.Int).SetBytes(vLog.Topics[3][:])
+		if rest, block, ok := strings.Cut(address, "@"); ok {
+			startBlock, err := strconv.ParseUint(strings.TrimSpace(block), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid start block in %s entry %q: %v", utils.ListenerContracts, entry, err)
+			}
+			c.StartBlock, address = &startBlock, rest
+		}
+
+		address = strings.TrimSpace(address)
+		if !common.IsHexAddress(address) {
+			return nil, fmt.Errorf("invalid address in %s entry %q", utils.ListenerContracts, entry)
+		}
+		c.Address = common.HexToAddress(address)
 
-		fmt.Println("Log Name: Transfer")
-		fmt.Printf("Transaction hash: %s\n", transferEvent.TxHash.Hex())
-		fmt.Printf("Block Number: %d\n", transferEvent.BlockNumber)
-		fmt.Printf("Block Hash: %s\n", transferEvent.BlockHash.Hex())
-		fmt.Printf("Sender Address: %s\n", transferEvent.From.Hex())
-		fmt.Printf("Recipient Address: %s\n", transferEvent.To.Hex())
-		fmt.Printf("Token ID: %s\n\n", transferEvent.TokenId.String())
+		contracts = append(contracts, c)
 	}
+
+	return contracts, nil
 }
 
-func listen(args ...string) error {
-	var err error
-	smartContract, err = contract.InitContract()
+func loadConfig() (listener.Config, error) {
+	var config listener.Config
+
+	chunkSize, err := utils.EnvUintHelper(utils.ListenerChunkSize, 0)
 	if err != nil {
-		log.Fatal(err)
+		return config, err
+	}
+	config.ChunkSize = chunkSize
+
+	confirmations, err := utils.EnvUintHelper(utils.ListenerConfirms, defaultConfirmations)
+	if err != nil {
+		return config, err
+	}
+	config.Confirmations = confirmations
+
+	useFinalizedTag, err := utils.EnvBoolHelper(utils.ListenerFinalized)
+	if err != nil {
+		return config, err
+	}
+	config.UseFinalizedTag = useFinalizedTag
+
+	providerURL, err := url.Parse(utils.EnvHelper(utils.ProviderKey))
+	if err != nil {
+		return config, fmt.Errorf("invalid provider url: %v", err)
+	}
+	config.Polling = providerURL.Scheme == "http" || providerURL.Scheme == "https"
+
+	pollInterval, err := utils.EnvDurationHelper(utils.ListenerPollPeriod, 0)
+	if err != nil {
+		return config, err
+	}
+	config.PollInterval = pollInterval
+	config.IPFSGatewayURL = utils.EnvHelper(utils.IPFSGatewayURL)
+
+	filter, err := loadFilter()
+	if err != nil {
+		return config, err
+	}
+	config.Filter = filter
+
+	return config, nil
+}
+
+func loadFilter() (listener.Filter, error) {
+	filter := listener.Filter{Events: utils.EnvListHelper(utils.ListenerEvents)}
+
+	addresses := func(key string) ([]common.Address, error) {
+		var addresses []common.Address
+		for _, value := range utils.EnvListHelper(key) {
+			if !common.IsHexAddress(value) {
+				return nil, fmt.Errorf("invalid address %q in %s", value, key)
+			}
+			addresses = append(addresses, common.HexToAddress(value))
+		}
+		return addresses, nil
 	}
 
-	query := ethereum.FilterQuery{
-		Addresses: []common.Address{smartContract.ContractAddress},
-		Topics:    [][]common.Hash{{crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))}},
+	var err error
+	if filter.From, err = addresses(utils.ListenerFilterFrom); err != nil {
+		return filter, err
 	}
+	if filter.To, err = addresses(utils.ListenerFilterTo); err != nil {
+		return filter, err
+	}
+
+	// Token IDs are given as single IDs or inclusive min-max ranges.
+	for _, value := range utils.EnvListHelper(utils.ListenerFilterToken) {
+		min, max, isRange := strings.Cut(value, "-")
+		if !isRange {
+			max = min
+		}
 
-	contractAbi, err = abi.JSON(strings.NewReader(string(checks.ChecksABI)))
+		tokenRange := listener.TokenRange{Min: new(big.Int), Max: new(big.Int)}
+		_, minOK := tokenRange.Min.SetString(strings.TrimSpace(min), 10)
+		_, maxOK := tokenRange.Max.SetString(strings.TrimSpace(max), 10)
+		if !minOK || !maxOK {
+			return filter, fmt.Errorf("invalid token id %q in %s", value, utils.ListenerFilterToken)
+		}
+		filter.TokenIDs = append(filter.TokenIDs, tokenRange)
+	}
+
+	return filter, nil
+}
+
+func listen(args ...string) error {
+	config, err := loadConfig()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	logs = make(chan types.Log)
-	sub, err := smartContract.ContractClient.SubscribeFilterLogs(context.Background(), query, logs)
+	contracts, err := loadContracts()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	fmt.Printf("Listening to the smart contract events. Waiting for new events...\n\n")
-	processEvents()
+	ctx, done := shutdown.Begin()
+	defer done()
 
-	for err := range sub.Err() {
-		log.Fatal(err)
+	sinks := []listener.Sink{listener.StdoutSink{}}
+	if webhookURLs := utils.EnvListHelper(utils.WebhookURLs); len(webhookURLs) > 0 {
+		sinks = append(sinks, webhook.NewSink(webhookURLs, webhookRepository))
+	}
+
+	feedAddress := utils.EnvHelper(utils.FeedAddress)
+	var hub *feed.Hub
+	if feedAddress != "" {
+		labels := make(map[common.Address]string)
+		for _, c := range contracts {
+			labels[c.Address] = c.Label
+		}
+		hub = feed.NewHub(eventRepository, labels, config.Filter, utils.EnvListHelper(utils.FeedAllowedOrigins))
+		sinks = append(sinks, hub)
+	}
+
+	// Each contract has a lock, and one listener follows all of its contracts
+	// over a single connection, so an instance leads once it holds the locks
+	// of all of them. Instances watching other contracts lead side by side.
+	var lockNames []string
+	for _, c := range contracts {
+		lockNames = append(lockNames, c.Address.Hex())
+	}
+	leader := database.NewLeader(database.DBInstance, instanceID(), lockNames)
+
+	var current atomic.Pointer[listener.Listener]
+	if address := utils.EnvHelper(utils.MetricsAddress); address != "" {
+		if err := serveHTTP(ctx, address, &current, leader, config); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if hub != nil {
+		serveFeed(ctx, feedAddress, hub)
+	}
+
+	for attempt := 0; ; {
+		if !leader.IsLeader() {
+			fmt.Printf("Instance %s is waiting to become the leader\n", leader.ID())
+		}
+		leaderCtx, err := leader.Campaign(ctx)
+		if err != nil {
+			return nil
+		}
+
+		fmt.Printf("Instance %s is the leader\n", leader.ID())
+		err = lead(leaderCtx, contracts, sinks, config, &current)
+		leader.Resign()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err == nil {
+			attempt = 0
+			continue
+		}
+
+		// Failures such as the provider being unreachable are usually
+		// transient, and a standby may have better luck meanwhile.
+		delay := utils.Backoff(attempt, minLeadRetryDelay, maxLeadRetryDelay)
+		attempt++
+		fmt.Printf("Leader stopped: %v\nCampaigning again in %s...\n\n", err, delay.Round(time.Millisecond))
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+	}
+}
+
+// lead runs the listener and the webhook dispatcher until ctx is cancelled.
+func lead(ctx context.Context, contracts []listener.Contract, sinks []listener.Sink, config listener.Config, current *atomic.Pointer[listener.Listener]) error {
+	client, err := contract.DialRPC(ctx)
+	if err != nil {
+		return err
+	}
+
+	var dispatcher sync.WaitGroup
+	if webhookURLs := utils.EnvListHelper(utils.WebhookURLs); len(webhookURLs) > 0 {
+		dispatcher.Add(1)
+		go func() {
+			defer dispatcher.Done()
+			webhook.NewDispatcher(utils.EnvHelper(utils.WebhookSecret), webhookRepository).Run(ctx)
+		}()
+	}
+
+	eventListener, err := listener.NewListener(client, contracts, listener.Repositories{
+		Events:      eventRepository,
+		Transfers:   transferRepository,
+		Minters:     minterRepository,
+		Tokens:      tokenRepository,
+		Metadata:    metadataRepository,
+		Checkpoints: checkpointRepository,
+	}, sinks, config)
+	if err != nil {
+		client.Close()
+		return err
+	}
+
+	current.Store(eventListener)
+	defer current.Store(nil)
+
+	err = eventListener.Run(ctx)
+	dispatcher.Wait()
+	return err
+}
+
+// instanceID tells listener instances apart in the health endpoints.
+func instanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("eventlistener %s/%d", hostname, os.Getpid())
+}
+
+// serveHTTP exposes /metrics, /healthz and /readyz in the background.
+// /healthz only fails when the listener or the election is stuck, /readyz
+// whenever a dependency is down or the listener is not caught up with the
+// chain, which includes standing by for another leader.
+func serveHTTP(ctx context.Context, address string, current *atomic.Pointer[listener.Listener], leader *database.Leader, config listener.Config) error {
+	maxHeadAge, err := utils.EnvDurationHelper(utils.HealthMaxHeadAge, defaultMaxHeadAge)
+	if err != nil {
+		return err
+	}
+
+	maxLag, err := utils.EnvUintHelper(utils.HealthMaxLag, defaultMaxLag)
+	if err != nil {
+		return err
+	}
+
+	progress := func() (uint64, bool) {
+		if eventListener := current.Load(); eventListener != nil {
+			return eventListener.Progress()
+		}
+		return 0, false
+	}
+	lastActive := func() time.Time {
+		if eventListener := current.Load(); eventListener != nil {
+			return eventListener.LastActive()
+		}
+		return leader.LastChecked()
+	}
+
+	chain := health.NewChain(contract.DialClient)
+	readiness := map[string]health.Check{
+		"provider": chain.Provider(maxHeadAge),
+		"database": health.Database(database.DBInstance),
+		"listener": chain.Lag(progress, maxLag),
+		"leader":   health.Leadership(leader, stallTimeout),
+	}
+	if config.IPFSGatewayURL != "" {
+		readiness["ipfs"] = health.IPFS(ipfs.NewClient(config.IPFSGatewayURL))
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/healthz", health.Handler(map[string]health.Check{
+		"listener": health.Activity(lastActive, stallTimeout),
+		"leader":   health.Leadership(leader, stallTimeout),
+	}))
+	mux.Handle("/readyz", health.Handler(readiness))
+
+	go func() {
+		if err := utils.Serve(ctx, address, mux); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+	}()
+
+	return nil
+}
+
+// serveFeed streams live events to browsers in the background, as
+// Server-Sent Events on /events and over a WebSocket on /events/ws.
+func serveFeed(ctx context.Context, address string, hub *feed.Hub) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", hub.ServeSSE)
+	mux.HandleFunc("/events/ws", hub.ServeWebSocket)
+
+	go func() {
+		// Streams only end when their client leaves, so they are closed first
+		// to let the server shut down.
+		<-ctx.Done()
+		hub.Close()
+	}()
+
+	go func() {
+		if err := utils.Serve(ctx, address, mux); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+	}()
+}
+
+func replay(args ...string) error {
+	usage := "Usage: replay <from block> <to block> [contract address] [event name]"
+	if len(args) < 2 || len(args) > 4 {
+		fmt.Println(usage)
+		return nil
+	}
+
+	var query listener.ReplayQuery
+	fromBlock, fromErr := strconv.ParseUint(args[0], 10, 64)
+	toBlock, toErr := strconv.ParseUint(args[1], 10, 64)
+	if fromErr != nil || toErr != nil || fromBlock > toBlock {
+		fmt.Println(usage)
+		return nil
+	}
+	query.FromBlock, query.ToBlock = fromBlock, toBlock
+
+	filter, err := loadFilter()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return nil
+	}
+	query.Filter = filter
+
+	for _, arg := range args[2:] {
+		if common.IsHexAddress(arg) {
+			query.Contract = common.HexToAddress(arg).Hex()
+		} else {
+			query.Event = arg
+		}
+	}
+
+	labels := make(map[common.Address]string)
+	if len(utils.EnvListHelper(utils.ListenerContracts)) > 0 {
+		contracts, err := loadContracts()
+		if err != nil {
+			fmt.Printf("failed to load contracts: %v\n", err)
+			return nil
+		}
+		for _, c := range contracts {
+			labels[c.Address] = c.Label
+		}
+	}
+
+	// Webhook deliveries are only queued here, a running listener delivers them.
+	sinks := []listener.Sink{listener.StdoutSink{}}
+	if webhookURLs := utils.EnvListHelper(utils.WebhookURLs); len(webhookURLs) > 0 {
+		sinks = append(sinks, webhook.NewSink(webhookURLs, webhookRepository))
+	}
+
+	ctx, done := shutdown.Begin()
+	defer done()
+
+	id := time.Now().UTC().Format("20060102T150405Z")
+	sent, err := listener.Replay(ctx, eventRepository, sinks, query, id, labels)
+	if err != nil {
+		fmt.Printf("replay %s stopped after %d events: %v\n", id, sent, err)
+		return nil
+	}
+
+	fmt.Printf("Replay %s sent %d events\n", id, sent)
+	return nil
+}
+
+func printTransfers(args ...string) error {
+	status := models.PendingTransferStatus
+	if len(args) > 0 && args[0] == "confirmed" {
+		status = models.ConfirmedTransferStatus
+	}
+
+	transfers, err := transferRepository.GetTransfersByStatus(status)
+	if err != nil {
+		fmt.Printf("failed to get transfers: %v\n", err)
+		return nil
+	}
+
+	for _, transfer := range transfers {
+		fmt.Printf("%d %s %s %s -> %s token %s\n", transfer.BlockNumber, transfer.ContractAddress, transfer.TxHash,
+			transfer.From, transfer.To, transfer.TokenID)
+	}
+
+	return nil
+}
+
+func printTokens(args ...string) error {
+	if len(args) < 2 || !common.IsHexAddress(args[1]) || (args[0] != "contract" && args[0] != "owner") {
+		fmt.Println("Usage: printTokens contract|owner <address>")
+		return nil
+	}
+
+	var (
+		tokens []models.Token
+		err    error
+	)
+	if args[0] == "owner" {
+		tokens, err = tokenRepository.GetTokensByOwner(common.HexToAddress(args[1]).Hex())
+	} else {
+		tokens, err = tokenRepository.GetAllTokens(common.HexToAddress(args[1]).Hex())
+	}
+	if err != nil {
+		fmt.Printf("failed to get tokens: %v\n", err)
+		return nil
+	}
+
+	for _, token := range tokens {
+		fmt.Printf("%s token %s owner %s minted in block %d\n", token.ContractAddress, token.TokenID, token.Owner, token.MintedBlock)
 	}
 
 	return nil
 }
 
+func printBalances(args ...string) error {
+	if len(args) == 0 || !common.IsHexAddress(args[0]) {
+		fmt.Println("Usage: printBalances <contract address>")
+		return nil
+	}
+
+	balances, err := tokenRepository.GetBalances(common.HexToAddress(args[0]).Hex())
+	if err != nil {
+		fmt.Printf("failed to get balances: %v\n", err)
+		return nil
+	}
+
+	for _, balance := range balances {
+		fmt.Printf("%s %d\n", balance.Address, balance.Balance)
+	}
+
+	return nil
+}
+
+func checkTokens(args ...string) error {
+	contracts, err := loadContracts()
+	if err != nil {
+		fmt.Printf("failed to load contracts: %v\n", err)
+		return nil
+	}
+
+	ctx, done := shutdown.Begin()
+	defer done()
+
+	client, err := contract.DialClient(ctx)
+	if err != nil {
+		fmt.Printf("failed to connect: %v\n", err)
+		return nil
+	}
+	defer client.Close()
+
+	for _, c := range contracts {
+		if ctx.Err() != nil {
+			break
+		}
+
+		mismatches, err := listener.CheckTokens(ctx, client, c.Address, tokenRepository)
+		if err != nil {
+			fmt.Printf("failed to check tokens of %s: %v\n", c.Address.Hex(), err)
+			continue
+		}
+
+		for _, mismatch := range mismatches {
+			if mismatch.Err != nil {
+				fmt.Printf("%s: indexed %s, on-chain call failed: %v\n", mismatch.Subject, mismatch.Indexed, mismatch.Err)
+				continue
+			}
+			fmt.Printf("%s: indexed %s, on-chain %s\n", mismatch.Subject, mismatch.Indexed, mismatch.OnChain)
+		}
+
+		fmt.Printf("Consistency check of %s finished with %d mismatches\n", c.Address.Hex(), len(mismatches))
+	}
+
+	return nil
+}
+
+func printWebhookDeliveries(args ...string) error {
+	statuses := map[string]int{
+		"pending":   models.PendingDeliveryStatus,
+		"delivered": models.DeliveredDeliveryStatus,
+		"failed":    models.FailedDeliveryStatus,
+	}
+
+	status := models.FailedDeliveryStatus
+	if len(args) > 0 {
+		var ok bool
+		if status, ok = statuses[args[0]]; !ok {
+			fmt.Println("Usage: printWebhookDeliveries [pending|delivered|failed]")
+			return nil
+		}
+	}
+
+	deliveries, err := webhookRepository.GetDeliveriesByStatus(status)
+	if err != nil {
+		fmt.Printf("failed to get webhook deliveries: %v\n", err)
+		return nil
+	}
+
+	for _, delivery := range deliveries {
+		replay := ""
+		if delivery.Replay {
+			replay = " (replay)"
+		}
+		fmt.Printf("%d %s %s%s %s attempts: %d %s\n", delivery.ID, delivery.URL, delivery.EventName, replay,
+			delivery.EventKey, delivery.Attempts, delivery.LastError)
+	}
+
+	return nil
+}
+
+func retryWebhooks(args ...string) error {
+	var ids []int64
+	for _, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			fmt.Printf("invalid delivery id %q\n", arg)
+			return nil
+		}
+		ids = append(ids, id)
+	}
+
+	retried, err := webhookRepository.RetryFailedDeliveries(ids)
+	if err != nil {
+		fmt.Printf("failed to retry webhook deliveries: %v\n", err)
+		return nil
+	}
+
+	fmt.Printf("%d webhook deliveries queued again\n", retried)
+	return nil
+}
+
 func main() {
+	shutdown = utils.HandleShutdown(func() {
+		database.DBInstance.Close()
+	})
+
 	commandOptions := []menu.CommandOption{
 		{Command: "listen", Description: "Start listening to the smart contract events", Function: listen},
+		{Command: "replay", Description: "Send stored events to the sinks again: replay <from block> <to block> [contract address] [event name]", Function: replay},
+		{Command: "printTransfers", Description: "Print stored transfers: printTransfers [pending|confirmed]", Function: printTransfers},
+		{Command: "printTokens", Description: "Print indexed tokens: printTokens contract|owner <address>", Function: printTokens},
+		{Command: "printBalances", Description: "Print indexed token balances of a contract: printBalances <contract address>", Function: printBalances},
+		{Command: "checkTokens", Description: "Compare indexed owners and balances with the watched contracts", Function: checkTokens},
+		{Command: "printWebhookDeliveries", Description: "Print webhook deliveries: printWebhookDeliveries [pending|delivered|failed]", Function: printWebhookDeliveries},
+		{Command: "retryWebhooks", Description: "Queue failed webhook deliveries again: retryWebhooks [id ...]", Function: retryWebhooks},
 	}
 	menuOptions := menu.NewMenuOptions("\n> ", 0)
 	menu := menu.NewMenu(commandOptions, menuOptions)
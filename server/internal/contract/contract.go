@@ -2,11 +2,16 @@ package contract
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"math/big"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"erc-721-checks/internal/checks"
+	"erc-721-checks/internal/metrics"
 	"erc-721-checks/internal/models"
 	"erc-721-checks/internal/utils"
 
@@ -15,30 +20,45 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
-const gasLimit = 300000
+const (
+	gasLimit = 300000
+	// pendingGracePeriod is how long a sent transaction is still waited for
+	// after the context was cancelled.
+	pendingGracePeriod = 30 * time.Second
+
+	GrantAction  = "grant"
+	RevokeAction = "revoke"
+	CancelAction = "cancel"
+)
+
+var actionNames = map[string]string{GrantAction: "Grant role", RevokeAction: "Revoke role", CancelAction: "Cancel nonce"}
 
 type SmartContract struct {
 	Instance        *checks.Checks
 	Auth            *bind.TransactOpts
 	ContractClient  *ethclient.Client
 	ContractAddress common.Address
+	Transactions    *TxManager
+	// Log receives the progress messages meant for people.
+	Log io.Writer
 }
 
-var minterRoleHash = crypto.Keccak256Hash([]byte("MINTER_ROLE"))
+var MinterRoleHash = crypto.Keccak256Hash([]byte("MINTER_ROLE"))
 
-func InitContract() (*SmartContract, error) {
-	contractClient, err := ethclient.Dial(utils.EnvHelper(utils.ProviderKey))
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to the Ethereum client: %v", err)
-	}
+// ErrTransactionPending is returned for transactions that were sent but not
+// mined before the context was cancelled, or whose outcome could not be read.
+// They may still be mined later.
+var ErrTransactionPending = errors.New("transaction still pending")
 
-	address, _ := utils.PromptContractAddress()
-	contractAddress := common.HexToAddress(address)
-	instance, err := checks.NewChecks(contractAddress, contractClient)
+// InitContract connects to the contract and reconciles the signer's stored
+// transactions with the chain. Progress messages are written to log.
+func InitContract(contractAddress common.Address, transactions *models.TransactionRepository, log io.Writer) (*SmartContract, error) {
+	contractClient, instance, err := dialContract(contractAddress)
 	if err != nil {
-		return nil, fmt.Errorf("failed to instantiate contract: %v", err)
+		return nil, err
 	}
 
 	privateKey, err := crypto.HexToECDSA(utils.EnvHelper(utils.SuperUserPrivateKey))
@@ -47,12 +67,6 @@ func InitContract() (*SmartContract, error) {
 	}
 	auth := bind.NewKeyedTransactor(privateKey)
 
-	nonce, err := contractClient.PendingNonceAt(context.Background(), auth.From)
-	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve account nonce: %v", err)
-	}
-	auth.Nonce = big.NewInt(int64(nonce))
-
 	gasPrice, err := contractClient.SuggestGasPrice(context.Background())
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve suggested gas price: %v", err)
@@ -60,79 +74,246 @@ func InitContract() (*SmartContract, error) {
 	auth.GasLimit = uint64(gasLimit)
 	auth.GasPrice = gasPrice
 
+	manager, err := NewTxManager(context.Background(), contractClient, transactions, auth, log)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := manager.Reconcile(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to reconcile transactions: %v", err)
+	}
+	if report.Pending+report.Mined+report.Failed+report.Replaced+report.Rebroadcast+report.Dropped > 0 {
+		fmt.Fprintln(log, report)
+	}
+
 	sc := &SmartContract{
 		Instance:        instance,
 		Auth:            auth,
 		ContractClient:  contractClient,
 		ContractAddress: contractAddress,
+		Transactions:    manager,
+		Log:             log,
 	}
 
 	return sc, nil
 }
 
-func (sc *SmartContract) GrantRole(address string, nonce uint64) error {
-	minter := common.HexToAddress(address)
-	sc.Auth.Nonce = big.NewInt(int64(nonce))
+// DialClient connects to the provider configured in the environment.
+func DialClient(ctx context.Context) (*ethclient.Client, error) {
+	rpcClient, err := DialRPC(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return ethclient.NewClient(rpcClient), nil
+}
 
-	tx, err := sc.Instance.SetMinter(sc.Auth, minter)
+// DialRPC connects to the provider for raw JSON-RPC calls, such as batches.
+func DialRPC(ctx context.Context) (*rpc.Client, error) {
+	rpcClient, err := rpc.DialContext(ctx, utils.EnvHelper(utils.ProviderKey))
 	if err != nil {
-		return fmt.Errorf("failed to grant role to minter: %s, %v", minter, err)
+		return nil, fmt.Errorf("failed to connect to the Ethereum client: %v", err)
 	}
 
-	receipt, err := bind.WaitMined(context.Background(), sc.ContractClient, tx)
+	return rpcClient, nil
+}
+
+func dialContract(contractAddress common.Address) (*ethclient.Client, *checks.Checks, error) {
+	contractClient, err := DialClient(context.Background())
 	if err != nil {
-		return fmt.Errorf("failed to wait for transaction to be mined: %v", err)
+		return nil, nil, err
 	}
 
-	if receipt.Status != types.ReceiptStatusSuccessful {
-		return fmt.Errorf("transaction failed: status %v", receipt.Status)
+	instance, err := checks.NewChecks(contractAddress, contractClient)
+	if err != nil {
+		contractClient.Close()
+		return nil, nil, fmt.Errorf("failed to instantiate contract: %v", err)
 	}
 
-	sc.Auth.Nonce = big.NewInt(int64(nonce + 1))
+	return contractClient, instance, nil
+}
 
-	fmt.Println("\nAction: Grant role")
-	fmt.Printf("To Address: %s\n", minter)
-	fmt.Printf("Status: %d\n", receipt.Status)
-	fmt.Printf("Nonce: %s\n", big.NewInt(int64(nonce)))
-	fmt.Printf("Transaction hash: %s\n", tx.Hash().Hex())
-	return nil
+// GrantRole sends a grant and waits for it to be mined. The transaction hash
+// is returned whenever it was sent.
+func (sc *SmartContract) GrantRole(ctx context.Context, address string) (common.Hash, error) {
+	return sc.changeRole(ctx, GrantAction, address)
+}
+
+// RevokeRole sends a revoke and waits for it to be mined. The transaction
+// hash is returned whenever it was sent.
+func (sc *SmartContract) RevokeRole(ctx context.Context, address string) (common.Hash, error) {
+	return sc.changeRole(ctx, RevokeAction, address)
+}
+
+func (sc *SmartContract) changeRole(ctx context.Context, action, address string) (common.Hash, error) {
+	tx, err := sc.SendRoleChange(ctx, action, address)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	receipt, err := sc.WaitTransaction(ctx, action, tx)
+	if err != nil {
+		return tx.Hash(), err
+	}
+
+	printReceipt(sc.Log, action, address, tx.Nonce(), receipt)
+	return receipt.TxHash, nil
+}
+
+// CancelNonce replaces whatever is pending with the nonce by a zero-value
+// transfer to the signer and waits for it to be mined.
+func (sc *SmartContract) CancelNonce(ctx context.Context, nonce uint64) (common.Hash, error) {
+	tx, err := sc.Transactions.Cancel(ctx, nonce)
+	if err != nil {
+		metrics.TransactionsFailed.WithLabelValues(CancelAction).Inc()
+		return common.Hash{}, fmt.Errorf("failed to cancel nonce %d: %v", nonce, err)
+	}
+	metrics.TransactionsSent.WithLabelValues(CancelAction).Inc()
+	fmt.Fprintf(sc.Log, "Sent cancellation of nonce %d: %s\n", nonce, tx.Hash().Hex())
+
+	receipt, err := sc.WaitTransaction(ctx, CancelAction, tx)
+	if err != nil {
+		return tx.Hash(), err
+	}
+
+	printReceipt(sc.Log, CancelAction, sc.Auth.From.Hex(), nonce, receipt)
+	return receipt.TxHash, nil
 }
 
-func (sc *SmartContract) RevokeRole(address string, nonce uint64) error {
+func printReceipt(w io.Writer, action, address string, nonce uint64, receipt *types.Receipt) {
+	fmt.Fprintf(w, "\nAction: %s\n", actionNames[action])
+	fmt.Fprintf(w, "To Address: %s\n", common.HexToAddress(address))
+	fmt.Fprintf(w, "Status: %d\n", receipt.Status)
+	fmt.Fprintf(w, "Nonce: %d\n", nonce)
+	fmt.Fprintf(w, "Transaction hash: %s\n", receipt.TxHash.Hex())
+}
+
+// SendRoleChange sends a GrantAction or RevokeAction through the transaction
+// manager without waiting for it to be mined, so several can be sent in a row.
+func (sc *SmartContract) SendRoleChange(ctx context.Context, action, address string) (*types.Transaction, error) {
+	return sc.sendRoleChange(ctx, action, address, nil, 0)
+}
+
+// sendRoleChange sends the role change at gasPrice with gasLimit, or at the
+// signer's defaults when they are nil and 0.
+func (sc *SmartContract) sendRoleChange(ctx context.Context, action, address string, gasPrice *big.Int, gasLimit uint64) (*types.Transaction, error) {
 	minter := common.HexToAddress(address)
-	sc.Auth.Nonce = big.NewInt(int64(nonce))
+	if action != GrantAction && action != RevokeAction {
+		return nil, fmt.Errorf("unknown role action %s", action)
+	}
 
-	tx, err := sc.Instance.RemoveMinter(sc.Auth, minter)
+	tx, err := sc.Transactions.Send(ctx, action, minter.Hex(), func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		if gasPrice != nil {
+			opts.GasPrice = gasPrice
+		}
+		if gasLimit > 0 {
+			opts.GasLimit = gasLimit
+		}
+		if action == GrantAction {
+			return sc.Instance.SetMinter(opts, minter)
+		}
+		return sc.Instance.RemoveMinter(opts, minter)
+	})
 	if err != nil {
-		return fmt.Errorf("failed to revoke role to minter: %s, %v", minter, err)
+		metrics.TransactionsFailed.WithLabelValues(action).Inc()
+		return nil, fmt.Errorf("failed to %s role to minter: %s, %v", action, minter, err)
 	}
+	metrics.TransactionsSent.WithLabelValues(action).Inc()
+
+	return tx, nil
+}
+
+// WaitTransaction waits for a transaction sent by SendRoleChange or
+// CancelNonce, or for its replacement with bumped fees, to be mined and fails
+// when it reverted.
+func (sc *SmartContract) WaitTransaction(ctx context.Context, action string, tx *types.Transaction) (*types.Receipt, error) {
+	return sc.waitTransaction(ctx, action, tx, sc.Transactions.Wait)
+}
 
-	receipt, err := bind.WaitMined(context.Background(), sc.ContractClient, tx)
+func (sc *SmartContract) waitTransaction(ctx context.Context, action string, tx *types.Transaction, wait waitFunc) (*types.Receipt, error) {
+	receipt, err := sc.waitMined(ctx, tx, wait)
 	if err != nil {
-		return fmt.Errorf("failed to wait for transaction to be mined: %v", err)
+		return nil, err
 	}
+	recordReceipt(action, receipt)
 
 	if receipt.Status != types.ReceiptStatusSuccessful {
-		return fmt.Errorf("transaction failed: status %v", receipt.Status)
+		return receipt, fmt.Errorf("transaction failed: status %v", receipt.Status)
 	}
 
-	sc.Auth.Nonce = big.NewInt(int64(nonce + 1))
+	return receipt, nil
+}
 
-	fmt.Println("\nAction: Revoke role")
-	fmt.Printf("To Address: %s\n", minter)
-	fmt.Printf("Status: %d\n", receipt.Status)
-	fmt.Printf("Nonce: %s\n", big.NewInt(int64(nonce)))
-	fmt.Printf("Transaction hash: %s\n", tx.Hash().Hex())
-	return nil
+// waitFunc is TxManager.Wait or TxManager.WaitUnbumped.
+type waitFunc func(ctx context.Context, tx *types.Transaction) (*types.Receipt, error)
+
+// waitMined waits for the transaction's receipt with wait. Once ctx is
+// cancelled the transaction is given pendingGracePeriod more, since it has
+// already been broadcast, and is reported as pending if it still was not mined.
+func (sc *SmartContract) waitMined(ctx context.Context, tx *types.Transaction, wait waitFunc) (*types.Receipt, error) {
+	receipt, err := wait(ctx, tx)
+	if err == nil {
+		return receipt, nil
+	}
+	if errors.Is(err, ErrTransactionPending) {
+		return nil, err
+	}
+	if ctx.Err() == nil {
+		return nil, fmt.Errorf("failed to wait for transaction to be mined: %v", err)
+	}
+
+	graceCtx, cancel := context.WithTimeout(context.Background(), pendingGracePeriod)
+	defer cancel()
+
+	receipt, err = wait(graceCtx, tx)
+	if err != nil && graceCtx.Err() == nil {
+		return nil, fmt.Errorf("failed to wait for transaction to be mined: %v", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s with nonce %d", ErrTransactionPending, tx.Hash().Hex(), tx.Nonce())
+	}
+
+	return receipt, nil
 }
 
-func (sc *SmartContract) SyncMinterRoles(minters []models.Minter, batchSize int) error {
-	var waitGroup sync.WaitGroup
-	currentNonce, err := sc.ContractClient.PendingNonceAt(context.Background(), sc.Auth.From)
+func recordReceipt(action string, receipt *types.Receipt) {
+	if receipt.Status == types.ReceiptStatusSuccessful {
+		metrics.TransactionsMined.WithLabelValues(action).Inc()
+	} else {
+		metrics.TransactionsFailed.WithLabelValues(action).Inc()
+	}
+
+	metrics.GasUsed.Add(float64(receipt.GasUsed))
+	if receipt.EffectiveGasPrice != nil {
+		fee := new(big.Int).Mul(receipt.EffectiveGasPrice, new(big.Int).SetUint64(receipt.GasUsed))
+		metrics.FeesSpent.Add(metrics.Ether(fee))
+	}
+}
+
+// UpdateSignerBalance refreshes the signer balance metric.
+func (sc *SmartContract) UpdateSignerBalance(ctx context.Context) error {
+	balance, err := sc.ContractClient.BalanceAt(ctx, sc.Auth.From, nil)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve account nonce: %v", err)
+		return fmt.Errorf("failed to retrieve signer balance: %v", err)
 	}
 
+	metrics.SignerBalance.Set(metrics.Ether(balance))
+	return nil
+}
+
+// SyncMinterRoles grants or revokes MINTER_ROLE until the chain matches the
+// given minters. When ctx is cancelled no further transactions are sent, the
+// ones in flight are waited for and the sync returns ctx's error. An error is
+// also returned when any transaction failed, or one wrapping
+// ErrTransactionPending when some were not mined yet.
+func (sc *SmartContract) SyncMinterRoles(ctx context.Context, minters []models.Minter, batchSize int) error {
+	var (
+		waitGroup sync.WaitGroup
+		sent      int
+		failed    atomic.Int32
+		pending   atomic.Int32
+	)
 	numBatches := (len(minters) + batchSize - 1) / batchSize
 	for i := 0; i < numBatches; i++ {
 		startIndex := i * batchSize
@@ -143,10 +324,16 @@ func (sc *SmartContract) SyncMinterRoles(minters []models.Minter, batchSize int)
 
 		batchMinters := minters[startIndex:endIndex]
 		for _, minter := range batchMinters {
+			if ctx.Err() != nil {
+				waitGroup.Wait()
+				return fmt.Errorf("sync interrupted before minter %s: %w", minter.Address, ctx.Err())
+			}
+
 			minterAddress := common.HexToAddress(minter.Address)
-			hasRole, err := sc.Instance.HasRole(nil, minterRoleHash, minterAddress)
+			hasRole, err := sc.Instance.HasRole(&bind.CallOpts{Context: ctx}, MinterRoleHash, minterAddress)
 			if err != nil {
-				fmt.Printf("failed to check if minter has role: %v\n", err)
+				waitGroup.Wait()
+				fmt.Fprintf(sc.Log, "failed to check if minter has role: %v\n", err)
 				return err
 			}
 
@@ -155,29 +342,39 @@ func (sc *SmartContract) SyncMinterRoles(minters []models.Minter, batchSize int)
 				if !hasRole {
 					waitGroup.Add(1)
 
-					go func(minter models.Minter, nonce uint64) {
+					go func(minter models.Minter) {
 						defer waitGroup.Done()
-						err := sc.GrantRole(minter.Address, nonce)
-						if err != nil {
-							fmt.Printf("failed to grant role to minter: %v\n", err)
+						_, err := sc.GrantRole(ctx, minter.Address)
+						switch {
+						case errors.Is(err, ErrTransactionPending):
+							pending.Add(1)
+							fmt.Fprintf(sc.Log, "%v\n", err)
+						case err != nil:
+							failed.Add(1)
+							fmt.Fprintf(sc.Log, "failed to grant role to minter: %v\n", err)
 						}
-					}(minter, currentNonce)
+					}(minter)
 
-					currentNonce++
+					sent++
 				}
 			case models.ArchivedMinterStatus:
 				if hasRole {
 					waitGroup.Add(1)
 
-					go func(minter models.Minter, nonce uint64) {
+					go func(minter models.Minter) {
 						defer waitGroup.Done()
-						err := sc.RevokeRole(minter.Address, nonce)
-						if err != nil {
-							fmt.Printf("failed to revoke role from minter: %v\n", err)
+						_, err := sc.RevokeRole(ctx, minter.Address)
+						switch {
+						case errors.Is(err, ErrTransactionPending):
+							pending.Add(1)
+							fmt.Fprintf(sc.Log, "%v\n", err)
+						case err != nil:
+							failed.Add(1)
+							fmt.Fprintf(sc.Log, "failed to revoke role from minter: %v\n", err)
 						}
-					}(minter, currentNonce)
+					}(minter)
 
-					currentNonce++
+					sent++
 				}
 			}
 		}
@@ -185,20 +382,25 @@ func (sc *SmartContract) SyncMinterRoles(minters []models.Minter, batchSize int)
 		waitGroup.Wait()
 	}
 
-	sc.Auth.Nonce = big.NewInt(int64(currentNonce))
+	if failed.Load() > 0 {
+		return fmt.Errorf("%d of %d transactions failed", failed.Load(), sent)
+	}
+	if pending.Load() > 0 {
+		return fmt.Errorf("%w: %d of %d transactions", ErrTransactionPending, pending.Load(), sent)
+	}
 	return nil
 }
 
-func (sc *SmartContract) GetMinters() ([]models.Minter, error) {
+func (sc *SmartContract) GetMinters(ctx context.Context) ([]models.Minter, error) {
 	opts := &bind.CallOpts{
-		Context: context.Background(),
+		Context: ctx,
 	}
 
-	minterCount, err := sc.Instance.GetRoleMemberCount(opts, minterRoleHash)
+	minterCount, err := sc.Instance.GetRoleMemberCount(opts, MinterRoleHash)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get minter count: %v", err)
 	}
-	fmt.Printf("Minters count: %s\n", minterCount)
+	fmt.Fprintf(sc.Log, "Minters count: %s\n", minterCount)
 
 	var (
 		waitGroup     sync.WaitGroup
@@ -208,9 +410,9 @@ func (sc *SmartContract) GetMinters() ([]models.Minter, error) {
 		waitGroup.Add(1)
 		go func(index uint64) {
 			defer waitGroup.Done()
-			minter, err := sc.Instance.GetRoleMember(opts, minterRoleHash, big.NewInt(int64(index)))
+			minter, err := sc.Instance.GetRoleMember(opts, MinterRoleHash, big.NewInt(int64(index)))
 			if err != nil {
-				fmt.Printf("Failed to get minter at index %d: %v\n", index, err)
+				fmt.Fprintf(sc.Log, "Failed to get minter at index %d: %v\n", index, err)
 				return
 			}
 			minterChannel <- minter
@@ -0,0 +1,263 @@
+package contract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"erc-721-checks/internal/models"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Plan lists the role changes needed for the chain to match the minters,
+// computed without sending anything. Amounts are in wei. A plan can be saved
+// as JSON and applied later, which sends exactly its changes.
+type Plan struct {
+	Contract  string       `json:"contract"`
+	Signer    string       `json:"signer"`
+	CreatedAt time.Time    `json:"createdAt"`
+	Minters   int          `json:"minters"`
+	Changes   []PlanChange `json:"changes"`
+	TotalGas  uint64       `json:"totalGas"`
+	GasPrice  string       `json:"gasPrice"`
+	TotalCost string       `json:"totalCost"`
+	Balance   string       `json:"balance"`
+}
+
+type PlanChange struct {
+	Action  string `json:"action"`
+	Address string `json:"address"`
+	Gas     uint64 `json:"gas"`
+}
+
+func (p Plan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Plan for %s created %s\n", p.Contract, p.CreatedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "%d minters in the database, %d changes\n", p.Minters, len(p.Changes))
+	for _, change := range p.Changes {
+		fmt.Fprintf(&b, "  %-6s %s (%d gas)\n", change.Action, change.Address, change.Gas)
+	}
+	fmt.Fprintf(&b, "Estimated gas: %d at %s gwei\n", p.TotalGas, formatUnits(p.GasPrice, params.GWei))
+	fmt.Fprintf(&b, "Estimated cost: %s ETH, signer %s holds %s ETH", formatUnits(p.TotalCost, params.Ether), p.Signer, formatUnits(p.Balance, params.Ether))
+	if cost, balance := parseWei(p.TotalCost), parseWei(p.Balance); cost.Cmp(balance) > 0 {
+		b.WriteString("\nWarning: the signer balance does not cover the estimated cost")
+	}
+	return b.String()
+}
+
+// PlanMinterRoles compares the minters with HasRole on chain and estimates
+// the gas of every grant and revoke a sync would send, at the current gas
+// price.
+func (sc *SmartContract) PlanMinterRoles(ctx context.Context, minters []models.Minter) (Plan, error) {
+	plan := Plan{
+		Contract:  sc.ContractAddress.Hex(),
+		Signer:    sc.Auth.From.Hex(),
+		CreatedAt: time.Now().UTC(),
+		Minters:   len(minters),
+		Changes:   []PlanChange{},
+	}
+
+	gasPrice, err := sc.ContractClient.SuggestGasPrice(ctx)
+	if err != nil {
+		return Plan{}, fmt.Errorf("failed to retrieve suggested gas price: %v", err)
+	}
+	balance, err := sc.ContractClient.BalanceAt(ctx, sc.Auth.From, nil)
+	if err != nil {
+		return Plan{}, fmt.Errorf("failed to retrieve signer balance: %v", err)
+	}
+
+	for _, minter := range minters {
+		hasRole, err := sc.Instance.HasRole(&bind.CallOpts{Context: ctx}, MinterRoleHash, common.HexToAddress(minter.Address))
+		if err != nil {
+			return Plan{}, fmt.Errorf("failed to check if minter has role: %v", err)
+		}
+
+		action := ""
+		switch {
+		case minter.Status == models.ActiveMinterStatus && !hasRole:
+			action = GrantAction
+		case minter.Status == models.ArchivedMinterStatus && hasRole:
+			action = RevokeAction
+		default:
+			continue
+		}
+
+		gas, err := sc.estimateRoleChange(ctx, action, minter.Address, gasPrice)
+		if err != nil {
+			return Plan{}, err
+		}
+		plan.Changes = append(plan.Changes, PlanChange{Action: action, Address: common.HexToAddress(minter.Address).Hex(), Gas: gas})
+		plan.TotalGas += gas
+	}
+
+	plan.GasPrice = gasPrice.String()
+	plan.TotalCost = new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(plan.TotalGas)).String()
+	plan.Balance = balance.String()
+	return plan, nil
+}
+
+// estimateRoleChange builds the transaction without sending it, which makes
+// the binding estimate its gas.
+func (sc *SmartContract) estimateRoleChange(ctx context.Context, action, address string, gasPrice *big.Int) (uint64, error) {
+	opts := *sc.Auth
+	opts.Context = ctx
+	opts.Nonce = new(big.Int)
+	opts.GasPrice = gasPrice
+	opts.GasLimit = 0
+	opts.NoSend = true
+
+	minter := common.HexToAddress(address)
+	var (
+		tx  *types.Transaction
+		err error
+	)
+	switch action {
+	case GrantAction:
+		tx, err = sc.Instance.SetMinter(&opts, minter)
+	case RevokeAction:
+		tx, err = sc.Instance.RemoveMinter(&opts, minter)
+	default:
+		return 0, fmt.Errorf("unknown role action %s", action)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to estimate gas to %s role to minter: %s, %v", action, minter, err)
+	}
+
+	return tx.Gas(), nil
+}
+
+// ApplyPlan sends the plan's changes and nothing else. It refuses plans made
+// for another contract or signer, plans older than maxAge and plans the chain
+// no longer matches, so what is sent is what was reviewed. Plans are also
+// refused when the gas price or the gas of a change rose above the estimate.
+// Every change is sent at the planned gas price and gas limit and its fees are
+// never bumped, so nothing costs more than the reviewed total. Like
+// SyncMinterRoles it stops sending when ctx is cancelled and fails when any
+// transaction failed.
+func (sc *SmartContract) ApplyPlan(ctx context.Context, plan Plan, batchSize int, maxAge time.Duration) error {
+	if !strings.EqualFold(plan.Contract, sc.ContractAddress.Hex()) {
+		return fmt.Errorf("plan is for contract %s, not %s", plan.Contract, sc.ContractAddress.Hex())
+	}
+	if !strings.EqualFold(plan.Signer, sc.Auth.From.Hex()) {
+		return fmt.Errorf("plan is for signer %s, not %s", plan.Signer, sc.Auth.From.Hex())
+	}
+	if age := time.Since(plan.CreatedAt); maxAge > 0 && age > maxAge {
+		return fmt.Errorf("plan was created %s ago, more than %s, create a new plan", age.Round(time.Second), maxAge)
+	}
+
+	plannedGasPrice, ok := new(big.Int).SetString(plan.GasPrice, 10)
+	if !ok || plannedGasPrice.Sign() <= 0 {
+		return fmt.Errorf("plan has an invalid gas price %q", plan.GasPrice)
+	}
+
+	gasPrice, err := sc.ContractClient.SuggestGasPrice(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve suggested gas price: %v", err)
+	}
+	if gasPrice.Cmp(plannedGasPrice) > 0 {
+		return fmt.Errorf("gas price rose to %s gwei from the planned %s gwei, create a new plan",
+			formatUnits(gasPrice.String(), params.GWei), formatUnits(plan.GasPrice, params.GWei))
+	}
+
+	for _, change := range plan.Changes {
+		if change.Action != GrantAction && change.Action != RevokeAction {
+			return fmt.Errorf("unknown role action %s for minter %s", change.Action, change.Address)
+		}
+		hasRole, err := sc.Instance.HasRole(&bind.CallOpts{Context: ctx}, MinterRoleHash, common.HexToAddress(change.Address))
+		if err != nil {
+			return fmt.Errorf("failed to check if minter has role: %v", err)
+		}
+		if hasRole == (change.Action == GrantAction) {
+			return fmt.Errorf("plan is out of date: %s for minter %s is no longer needed, create a new plan", change.Action, change.Address)
+		}
+
+		gas, err := sc.estimateRoleChange(ctx, change.Action, change.Address, gasPrice)
+		if err != nil {
+			return err
+		}
+		if gas > change.Gas {
+			return fmt.Errorf("gas to %s minter %s rose to %d from the planned %d, create a new plan", change.Action, change.Address, gas, change.Gas)
+		}
+	}
+
+	var (
+		waitGroup sync.WaitGroup
+		sent      int
+		failed    atomic.Int32
+		pending   atomic.Int32
+	)
+	for i, change := range plan.Changes {
+		if i > 0 && i%batchSize == 0 {
+			waitGroup.Wait()
+		}
+		if ctx.Err() != nil {
+			waitGroup.Wait()
+			return fmt.Errorf("plan interrupted before minter %s: %w", change.Address, ctx.Err())
+		}
+
+		waitGroup.Add(1)
+		go func(change PlanChange) {
+			defer waitGroup.Done()
+			_, err := sc.applyChange(ctx, change, plannedGasPrice)
+			switch {
+			case errors.Is(err, ErrTransactionPending):
+				pending.Add(1)
+				fmt.Fprintf(sc.Log, "%v\n", err)
+			case err != nil:
+				failed.Add(1)
+				fmt.Fprintf(sc.Log, "%v\n", err)
+			}
+		}(change)
+
+		sent++
+	}
+
+	waitGroup.Wait()
+	if failed.Load() > 0 {
+		return fmt.Errorf("%d of %d transactions failed", failed.Load(), sent)
+	}
+	if pending.Load() > 0 {
+		return fmt.Errorf("%w: %d of %d transactions", ErrTransactionPending, pending.Load(), sent)
+	}
+	return nil
+}
+
+// applyChange sends the change at the planned gas price and gas limit and
+// waits for it without bumping its fees.
+func (sc *SmartContract) applyChange(ctx context.Context, change PlanChange, gasPrice *big.Int) (common.Hash, error) {
+	tx, err := sc.sendRoleChange(ctx, change.Action, change.Address, gasPrice, change.Gas)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	receipt, err := sc.waitTransaction(ctx, change.Action, tx, sc.Transactions.WaitUnbumped)
+	if err != nil {
+		return tx.Hash(), err
+	}
+
+	printReceipt(sc.Log, change.Action, change.Address, tx.Nonce(), receipt)
+	return receipt.TxHash, nil
+}
+
+func parseWei(value string) *big.Int {
+	wei, ok := new(big.Int).SetString(value, 10)
+	if !ok {
+		return new(big.Int)
+	}
+	return wei
+}
+
+// formatUnits formats a wei amount in the given unit, e.g. params.Ether.
+func formatUnits(value string, unit float64) string {
+	amount, _ := new(big.Float).Quo(new(big.Float).SetInt(parseWei(value)), big.NewFloat(unit)).Float64()
+	return fmt.Sprintf("%.9g", amount)
+}
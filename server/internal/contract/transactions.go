@@ -0,0 +1,670 @@
+package contract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"erc-721-checks/internal/metrics"
+	"erc-721-checks/internal/models"
+	"erc-721-checks/internal/utils"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	defaultStuckAfter   = 3 * time.Minute
+	receiptPollInterval = 2 * time.Second
+	// feeBumpPercent is how much a replacement raises the gas price. Nodes
+	// reject replacements that raise it by less than 10%.
+	feeBumpPercent = 20
+	// maxRepositoryErrors is how many polls in a row Wait may fail to read the
+	// stored transactions before giving up.
+	maxRepositoryErrors = 5
+)
+
+// TxManager allocates the signer's nonces and stores every transaction before
+// broadcasting it, so nonces stay consistent across goroutines, processes
+// sharing the signer and restarts.
+type TxManager struct {
+	client       *ethclient.Client
+	transactions *models.TransactionRepository
+	auth         *bind.TransactOpts
+	chainID      int64
+	// stuckAfter is how long a transaction may be pending before it is sent
+	// again with bumped fees, up to maxGasPrice when that is set.
+	stuckAfter  time.Duration
+	maxGasPrice *big.Int
+	// mutex keeps goroutines from holding pool connections while they wait for
+	// the advisory lock.
+	mutex sync.Mutex
+	log   io.Writer
+}
+
+// ReconcileReport counts what Reconcile found for the stored pending
+// transactions. Gaps are nonces without a transaction below pending ones.
+type ReconcileReport struct {
+	Pending     int
+	Mined       int
+	Failed      int
+	Replaced    int
+	Rebroadcast int
+	Dropped     int
+	Gaps        []uint64
+}
+
+func (r ReconcileReport) String() string {
+	report := fmt.Sprintf("Transactions: %d pending, %d mined, %d failed, %d replaced, %d broadcast again, %d dropped",
+		r.Pending, r.Mined, r.Failed, r.Replaced, r.Rebroadcast, r.Dropped)
+	for _, nonce := range r.Gaps {
+		report += fmt.Sprintf("\nNonce %d has no pending transaction, the ones after it are not mined until the next transaction takes it", nonce)
+	}
+	return report
+}
+
+func NewTxManager(ctx context.Context, client *ethclient.Client, transactions *models.TransactionRepository, auth *bind.TransactOpts, log io.Writer) (*TxManager, error) {
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve chain id: %v", err)
+	}
+
+	stuckAfter, err := utils.EnvDurationHelper(utils.AdminStuckAfter, defaultStuckAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	manager := &TxManager{client: client, transactions: transactions, auth: auth, chainID: chainID.Int64(), stuckAfter: stuckAfter, log: log}
+
+	maxGasPrice, err := utils.EnvUintHelper(utils.AdminMaxGasPrice, 0)
+	if err != nil {
+		return nil, err
+	}
+	if maxGasPrice > 0 {
+		manager.maxGasPrice = new(big.Int).Mul(new(big.Int).SetUint64(maxGasPrice), big.NewInt(params.GWei))
+	}
+
+	return manager, nil
+}
+
+// StuckTransaction is the latest transaction of a nonce that has been pending
+// for longer than ADMIN_STUCK_AFTER, and the replacement sent for it.
+type StuckTransaction struct {
+	Nonce       uint64 `json:"nonce"`
+	Hash        string `json:"txHash"`
+	Action      string `json:"action"`
+	Target      string `json:"target,omitempty"`
+	PendingFor  string `json:"pendingFor"`
+	Replacement string `json:"replacement,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// Send builds a transaction for the next free nonce with build, stores it and
+// broadcasts it. The options given to build must not send the transaction.
+// The next free nonce is the node's pending nonce, skipping the nonces of
+// stored transactions that are not broadcast yet.
+func (m *TxManager) Send(ctx context.Context, action, target string, build func(opts *bind.TransactOpts) (*types.Transaction, error)) (*types.Transaction, error) {
+	var tx *types.Transaction
+
+	m.mutex.Lock()
+	_, err := m.transactions.ReserveNonce(m.chainID, m.auth.From.Hex(), func(pending map[uint64]bool) (models.Transaction, error) {
+		nonce, err := m.client.PendingNonceAt(ctx, m.auth.From)
+		if err != nil {
+			return models.Transaction{}, fmt.Errorf("failed to retrieve account nonce: %v", err)
+		}
+		for pending[nonce] {
+			nonce++
+		}
+
+		opts := *m.auth
+		opts.Context = ctx
+		opts.Nonce = new(big.Int).SetUint64(nonce)
+		opts.NoSend = true
+		if tx, err = build(&opts); err != nil {
+			return models.Transaction{}, err
+		}
+
+		payload, err := tx.MarshalBinary()
+		if err != nil {
+			return models.Transaction{}, fmt.Errorf("failed to encode transaction: %v", err)
+		}
+
+		return models.Transaction{Nonce: nonce, Hash: tx.Hash().Hex(), Action: action, Target: target, Payload: hexutil.Encode(payload)}, nil
+	})
+	m.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.broadcast(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// Wait waits until the transaction or one of its replacements is mined and
+// returns that receipt. It fails when another transaction of the nonce, such
+// as a cancellation, was mined instead. Whenever the latest replacement has
+// been pending for longer than ADMIN_STUCK_AFTER, it is replaced by one with
+// the same nonce and bumped fees. When the stored transactions cannot be read
+// maxRepositoryErrors times in a row, it gives up with ErrTransactionPending.
+func (m *TxManager) Wait(ctx context.Context, tx *types.Transaction) (*types.Receipt, error) {
+	return m.wait(ctx, tx, true)
+}
+
+// WaitUnbumped waits like Wait but never replaces the transaction, for
+// transactions whose price was agreed on beforehand.
+func (m *TxManager) WaitUnbumped(ctx context.Context, tx *types.Transaction) (*types.Receipt, error) {
+	return m.wait(ctx, tx, false)
+}
+
+func (m *TxManager) wait(ctx context.Context, tx *types.Transaction, bump bool) (*types.Receipt, error) {
+	original, err := m.transactions.GetTransaction(tx.Hash().Hex())
+	if err != nil {
+		return nil, err
+	}
+	lastAttempt := time.Now()
+	repositoryErrors := 0
+
+	ticker := time.NewTicker(receiptPollInterval)
+	defer ticker.Stop()
+	for {
+		// The nonce is read before the receipts, so a used nonce without any
+		// receipt means a transaction that is not stored took it.
+		nonce, nonceErr := m.client.NonceAt(ctx, m.auth.From, nil)
+
+		// Replacements and cancellations may be sent by other processes, so
+		// the transactions of the nonce are read again every time.
+		records, err := m.transactions.GetTransactionsByNonce(m.chainID, m.auth.From.Hex(), tx.Nonce())
+		if err != nil {
+			repositoryErrors++
+			if repositoryErrors >= maxRepositoryErrors {
+				return nil, fmt.Errorf("%w: %s with nonce %d, failed to read its transactions: %v", ErrTransactionPending, tx.Hash().Hex(), tx.Nonce(), err)
+			}
+			fmt.Fprintf(m.log, "%v\n", err)
+		} else {
+			repositoryErrors = 0
+		}
+
+		var latest *models.Transaction
+		for i, record := range records {
+			if record.Status == models.DroppedTransactionStatus {
+				continue
+			}
+			latest = &records[i]
+
+			receipt, err := m.client.TransactionReceipt(ctx, common.HexToHash(record.Hash))
+			if err != nil {
+				continue
+			}
+			m.confirm(record.Hash, record.Nonce, receipt)
+			if record.Action != original.Action || record.Target != original.Target {
+				return nil, fmt.Errorf("nonce %d was used by %s transaction %s", tx.Nonce(), record.Action, record.Hash)
+			}
+			return receipt, nil
+		}
+
+		if nonceErr == nil && nonce > tx.Nonce() && err == nil {
+			for _, record := range records {
+				if record.Status == models.PendingTransactionStatus {
+					m.setStatus(record.Hash, models.ReplacedTransactionStatus, 0, fmt.Sprintf("nonce %d was used by another transaction", tx.Nonce()))
+				}
+			}
+			return nil, fmt.Errorf("nonce %d was used by another transaction", tx.Nonce())
+		}
+
+		// A cancellation of the nonce is left alone.
+		if bump && latest != nil && latest.Action == original.Action && latest.Target == original.Target &&
+			time.Since(latest.CreatedAt) >= m.stuckAfter && time.Since(lastAttempt) >= m.stuckAfter {
+			if replacement, err := m.replace(ctx, *latest); err != nil {
+				fmt.Fprintf(m.log, "failed to replace stuck transaction %s: %v\n", latest.Hash, err)
+			} else {
+				fmt.Fprintf(m.log, "Transaction %s with nonce %d was pending for %s, replaced by %s with gas price %s wei\n",
+					latest.Hash, latest.Nonce, time.Since(latest.CreatedAt).Round(time.Second), replacement.Hash().Hex(), replacement.GasPrice())
+			}
+			lastAttempt = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Transaction returns the stored transaction with the hash, both as stored
+// and decoded from its payload.
+func (m *TxManager) Transaction(hash string) (models.Transaction, *types.Transaction, error) {
+	record, err := m.transactions.GetTransaction(hash)
+	if err != nil {
+		return models.Transaction{}, nil, err
+	}
+
+	tx, err := decodeTransaction(record.Payload)
+	if err != nil {
+		return models.Transaction{}, nil, err
+	}
+	return record, tx, nil
+}
+
+// Stuck reconciles the stored transactions and returns the latest transaction
+// of every nonce that has been pending for longer than ADMIN_STUCK_AFTER.
+func (m *TxManager) Stuck(ctx context.Context) ([]StuckTransaction, error) {
+	if _, err := m.Reconcile(ctx); err != nil {
+		return nil, err
+	}
+
+	pending, err := m.transactions.GetPendingTransactions(m.chainID, m.auth.From.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	// Pending transactions are ordered by nonce and id, so the last one of a
+	// nonce is its latest replacement.
+	var latest []models.Transaction
+	for _, record := range pending {
+		if len(latest) > 0 && latest[len(latest)-1].Nonce == record.Nonce {
+			latest[len(latest)-1] = record
+		} else {
+			latest = append(latest, record)
+		}
+	}
+
+	stuck := []StuckTransaction{}
+	for _, record := range latest {
+		if pendingFor := time.Since(record.CreatedAt); pendingFor >= m.stuckAfter {
+			stuck = append(stuck, StuckTransaction{Nonce: record.Nonce, Hash: record.Hash, Action: record.Action,
+				Target: record.Target, PendingFor: pendingFor.Round(time.Second).String()})
+		}
+	}
+
+	return stuck, nil
+}
+
+// BumpStuck replaces every stuck transaction by one with the same nonce and
+// bumped fees, without waiting for them.
+func (m *TxManager) BumpStuck(ctx context.Context) ([]StuckTransaction, error) {
+	stuck, err := m.Stuck(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range stuck {
+		record, err := m.transactions.GetTransaction(stuck[i].Hash)
+		if err != nil {
+			stuck[i].Error = err.Error()
+			continue
+		}
+
+		tx, err := m.replace(ctx, record)
+		if err != nil {
+			stuck[i].Error = err.Error()
+			continue
+		}
+		stuck[i].Replacement = tx.Hash().Hex()
+	}
+
+	return stuck, nil
+}
+
+// Cancel sends a zero-value transfer to the signer with the nonce, priced
+// above every pending transaction of the nonce so it replaces them. A nonce at
+// or past the pending nonce of the account is refused unless a stored
+// transaction waits on it, as cancelling it would only use up the nonce.
+func (m *TxManager) Cancel(ctx context.Context, nonce uint64) (*types.Transaction, error) {
+	latest, err := m.client.NonceAt(ctx, m.auth.From, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve account nonce: %v", err)
+	}
+	if nonce < latest {
+		return nil, fmt.Errorf("nonce %d was already used", nonce)
+	}
+
+	pendingNonce, err := m.client.PendingNonceAt(ctx, m.auth.From)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve pending nonce: %v", err)
+	}
+
+	pending, err := m.transactions.GetPendingTransactions(m.chainID, m.auth.From.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	// A stored transaction with a higher nonce waits on this one, so a missing
+	// nonce is filled even when the node does not know it.
+	stored, blocking := false, false
+	highest := new(big.Int)
+	for _, record := range pending {
+		if record.Nonce > nonce {
+			blocking = true
+		}
+		if record.Nonce != nonce {
+			continue
+		}
+		stored = true
+		if tx, err := decodeTransaction(record.Payload); err == nil && tx.GasPrice().Cmp(highest) > 0 {
+			highest = tx.GasPrice()
+		}
+	}
+	if !stored && !blocking && nonce >= pendingNonce {
+		return nil, fmt.Errorf("nothing is pending with nonce %d, the next nonce is %d", nonce, pendingNonce)
+	}
+
+	gasPrice, err := m.bumpGasPrice(ctx, highest)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := m.submit(ctx, CancelAction, "", &types.LegacyTx{
+		Nonce:    nonce,
+		To:       &m.auth.From,
+		Value:    new(big.Int),
+		Gas:      params.TxGas,
+		GasPrice: gasPrice,
+	})
+	if err != nil && !stored && nonce < pendingNonce && strings.Contains(strings.ToLower(err.Error()), "underpriced") {
+		// The node holds a transaction for the nonce that was not sent through
+		// the admin cli, so its price is unknown here.
+		return nil, fmt.Errorf("nonce %d is held by a transaction sent outside the admin cli at a higher gas price, cancel it with the wallet that sent it: %v", nonce, err)
+	}
+	return tx, err
+}
+
+// replace sends the stored transaction again with bumped fees.
+func (m *TxManager) replace(ctx context.Context, record models.Transaction) (*types.Transaction, error) {
+	tx, err := decodeTransaction(record.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	gasPrice, err := m.bumpGasPrice(ctx, tx.GasPrice())
+	if err != nil {
+		return nil, err
+	}
+
+	var replacement *types.Transaction
+	m.mutex.Lock()
+	latest, replaced, err := m.transactions.ReplaceTransaction(m.chainID, m.auth.From.Hex(), tx.Nonce(), record.Hash, func() (models.Transaction, error) {
+		tx, stored, err := m.sign(record.Action, record.Target, &types.LegacyTx{
+			Nonce:    tx.Nonce(),
+			To:       tx.To(),
+			Value:    tx.Value(),
+			Gas:      tx.Gas(),
+			GasPrice: gasPrice,
+			Data:     tx.Data(),
+		})
+		replacement = tx
+		return stored, err
+	})
+	m.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if !replaced {
+		// Another waiter or process replaced it first.
+		return decodeTransaction(latest.Payload)
+	}
+
+	if err := m.broadcast(ctx, replacement); err != nil {
+		return nil, fmt.Errorf("failed to send transaction: %v", err)
+	}
+
+	metrics.TransactionsReplaced.WithLabelValues(record.Action).Inc()
+	return replacement, nil
+}
+
+// bumpGasPrice raises the gas price by feeBumpPercent, or to the current gas
+// price when that is higher.
+func (m *TxManager) bumpGasPrice(ctx context.Context, gasPrice *big.Int) (*big.Int, error) {
+	bumped := new(big.Int).Mul(gasPrice, big.NewInt(100+feeBumpPercent))
+	bumped.Add(bumped, big.NewInt(99)).Div(bumped, big.NewInt(100))
+
+	suggested, err := m.client.SuggestGasPrice(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve suggested gas price: %v", err)
+	}
+	if suggested.Cmp(bumped) > 0 {
+		bumped = suggested
+	}
+
+	if m.maxGasPrice != nil && bumped.Cmp(m.maxGasPrice) > 0 {
+		return nil, fmt.Errorf("gas price %s wei is above ADMIN_MAX_GAS_PRICE", bumped)
+	}
+	return bumped, nil
+}
+
+// submit signs, stores and broadcasts a transaction for a nonce that is
+// already taken by the signer's pending transactions.
+func (m *TxManager) submit(ctx context.Context, action, target string, data types.TxData) (*types.Transaction, error) {
+	tx, record, err := m.sign(action, target, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := m.transactions.CreateTransaction(record); err != nil {
+		return nil, err
+	}
+
+	if err := m.broadcast(ctx, tx); err != nil {
+		return nil, fmt.Errorf("failed to send transaction: %v", err)
+	}
+
+	return tx, nil
+}
+
+// sign signs the transaction and returns it with the record to store for it.
+func (m *TxManager) sign(action, target string, data types.TxData) (*types.Transaction, models.Transaction, error) {
+	tx, err := m.auth.Signer(m.auth.From, types.NewTx(data))
+	if err != nil {
+		return nil, models.Transaction{}, fmt.Errorf("failed to sign transaction: %v", err)
+	}
+
+	payload, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, models.Transaction{}, fmt.Errorf("failed to encode transaction: %v", err)
+	}
+
+	return tx, models.Transaction{ChainID: m.chainID, Sender: m.auth.From.Hex(), Nonce: tx.Nonce(),
+		Hash: tx.Hash().Hex(), Action: action, Target: target, Payload: hexutil.Encode(payload)}, nil
+}
+
+// broadcast sends a stored transaction and marks it dropped when the node
+// rejects it. When the broadcast fails on the way instead, e.g. on a timeout
+// or a reset connection, the node may have received it, so it stays pending:
+// waiting for it finds it mined or replaces it once stuck, and Reconcile
+// broadcasts it again.
+func (m *TxManager) broadcast(ctx context.Context, tx *types.Transaction) error {
+	err := m.client.SendTransaction(ctx, tx)
+	switch {
+	case err == nil || isKnownTransaction(err):
+		return nil
+	case isRejected(err):
+		// A node that has the transaction took it, whatever it answered.
+		if _, _, lookupErr := m.client.TransactionByHash(ctx, tx.Hash()); lookupErr == nil {
+			return nil
+		}
+		m.setStatus(tx.Hash().Hex(), models.DroppedTransactionStatus, 0, err.Error())
+		return err
+	default:
+		fmt.Fprintf(m.log, "Broadcasting transaction %s with nonce %d may have failed, keeping it pending: %v\n", tx.Hash().Hex(), tx.Nonce(), err)
+		return nil
+	}
+}
+
+func (m *TxManager) confirm(hash string, nonce uint64, receipt *types.Receipt) {
+	status, lastError := models.MinedTransactionStatus, ""
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		status, lastError = models.FailedTransactionStatus, fmt.Sprintf("transaction failed: status %v", receipt.Status)
+	}
+	m.setStatus(hash, status, receipt.BlockNumber.Uint64(), lastError)
+
+	if err := m.transactions.ReplaceNonce(m.chainID, m.auth.From.Hex(), nonce, hash); err != nil {
+		fmt.Fprintf(m.log, "%v\n", err)
+	}
+}
+
+func (m *TxManager) setStatus(hash string, status int, blockNumber uint64, lastError string) {
+	if err := m.transactions.UpdateTransactionStatus(hash, status, blockNumber, lastError); err != nil {
+		fmt.Fprintf(m.log, "%v\n", err)
+	}
+}
+
+// Reconcile brings the stored pending transactions in line with the chain,
+// e.g. after a crash. Mined ones are recorded, ones whose nonce was used by
+// another transaction are marked replaced, and ones the node does not know
+// are broadcast again from their stored payload, or dropped when the node
+// rejects them.
+func (m *TxManager) Reconcile(ctx context.Context) (ReconcileReport, error) {
+	var report ReconcileReport
+
+	pending, err := m.transactions.GetPendingTransactions(m.chainID, m.auth.From.Hex())
+	if err != nil {
+		return report, err
+	}
+	if len(pending) == 0 {
+		return report, nil
+	}
+
+	latest, err := m.client.NonceAt(ctx, m.auth.From, nil)
+	if err != nil {
+		return report, fmt.Errorf("failed to retrieve account nonce: %v", err)
+	}
+
+	live := make(map[uint64]bool)
+	var highest uint64
+	for _, record := range pending {
+		hash := common.HexToHash(record.Hash)
+
+		receipt, err := m.client.TransactionReceipt(ctx, hash)
+		if err == nil {
+			m.confirm(record.Hash, record.Nonce, receipt)
+			if receipt.Status == types.ReceiptStatusSuccessful {
+				report.Mined++
+			} else {
+				report.Failed++
+			}
+			continue
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			return report, fmt.Errorf("failed to get receipt of %s: %v", record.Hash, err)
+		}
+
+		if record.Nonce < latest {
+			m.setStatus(record.Hash, models.ReplacedTransactionStatus, 0, fmt.Sprintf("nonce %d was used by another transaction", record.Nonce))
+			report.Replaced++
+			continue
+		}
+
+		if _, _, err := m.client.TransactionByHash(ctx, hash); err == nil {
+			report.Pending++
+		} else if !errors.Is(err, ethereum.NotFound) {
+			return report, fmt.Errorf("failed to get transaction %s: %v", record.Hash, err)
+		} else if err := m.rebroadcast(ctx, record); err != nil {
+			m.setStatus(record.Hash, models.DroppedTransactionStatus, 0, err.Error())
+			report.Dropped++
+			continue
+		} else {
+			report.Rebroadcast++
+		}
+
+		live[record.Nonce] = true
+		if record.Nonce > highest {
+			highest = record.Nonce
+		}
+	}
+
+	if len(live) > 0 {
+		for nonce := latest; nonce < highest; nonce++ {
+			if !live[nonce] {
+				report.Gaps = append(report.Gaps, nonce)
+			}
+		}
+	}
+
+	return report, nil
+}
+
+func (m *TxManager) rebroadcast(ctx context.Context, record models.Transaction) error {
+	tx, err := decodeTransaction(record.Payload)
+	if err != nil {
+		return err
+	}
+
+	if err := m.broadcast(ctx, tx); err != nil {
+		return fmt.Errorf("failed to broadcast transaction again: %v", err)
+	}
+	return nil
+}
+
+func decodeTransaction(payload string) (*types.Transaction, error) {
+	encoded, err := hexutil.Decode(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode stored transaction: %v", err)
+	}
+
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(encoded); err != nil {
+		return nil, fmt.Errorf("failed to decode stored transaction: %v", err)
+	}
+	return tx, nil
+}
+
+// isRejected reports whether the node answered with an error, as opposed to
+// the request failing before an answer arrived.
+func isRejected(err error) bool {
+	var rpcErr rpc.Error
+	return errors.As(err, &rpcErr)
+}
+
+// knownTransactionErrors are the ways nodes say they already had a
+// transaction: geth's "already known" and Nethermind's AlreadyKnown. Besu's
+// "Known transaction" is matched as a whole word in isKnownTransaction, as
+// "unknown transaction" is a rejection.
+var knownTransactionErrors = []string{"already known", "alreadyknown"}
+
+// isKnownTransaction reports whether the node already had the transaction,
+// which means the broadcast went through. Errors from the node arrive as plain
+// strings, so they are matched by message.
+func isKnownTransaction(err error) bool {
+	message := strings.ToLower(err.Error())
+	for _, known := range knownTransactionErrors {
+		if strings.Contains(message, known) {
+			return true
+		}
+	}
+	return containsWord(message, "known transaction")
+}
+
+// containsWord reports whether word appears in message without a letter or
+// digit right before or after it.
+func containsWord(message, word string) bool {
+	for offset := 0; offset < len(message); {
+		i := strings.Index(message[offset:], word)
+		if i < 0 {
+			return false
+		}
+		start, end := offset+i, offset+i+len(word)
+		if (start == 0 || !isWordByte(message[start-1])) && (end == len(message) || !isWordByte(message[end])) {
+			return true
+		}
+		offset = start + 1
+	}
+	return false
+}
+
+func isWordByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b == '_'
+}
@@ -0,0 +1,33 @@
+package contract
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIsKnownTransaction(t *testing.T) {
+	tests := []struct {
+		message string
+		known   bool
+	}{
+		{message: "already known", known: true},
+		{message: "ALREADY KNOWN", known: true},
+		{message: "AlreadyKnown, transaction already in pool", known: true},
+		{message: "Known transaction", known: true},
+		{message: "known transaction: 0xabc", known: true},
+		{message: "rejected: known transaction", known: true},
+		{message: "unknown transaction", known: false},
+		{message: "Unknown transaction 0xabc", known: false},
+		{message: "nonce too low", known: false},
+		{message: "replacement transaction underpriced", known: false},
+		{message: "known transactions pruned", known: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.message, func(t *testing.T) {
+			if known := isKnownTransaction(errors.New(test.message)); known != test.known {
+				t.Errorf("isKnownTransaction(%q) = %v, want %v", test.message, known, test.known)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// leaderCheckInterval is how often a standby tries to take the lock and the
+// leader checks that its connection, and with it the lock, is still alive.
+const leaderCheckInterval = 5 * time.Second
+
+// ErrLeadershipLost is the cause of the leader context's cancellation when the
+// lock was lost. Another instance may be leading by then, so the work done
+// as leader should stop without writing anything more.
+var ErrLeadershipLost = errors.New("leadership lost")
+
+// Leader elects a single active instance through Postgres advisory locks, one
+// per name. An instance leads once it holds all of them, so instances sharing
+// none of the names lead side by side. The locks are held by a dedicated
+// connection, so Postgres releases them as soon as the leader's connection
+// drops and a standby takes over.
+type Leader struct {
+	db    *sql.DB
+	id    string
+	names []string
+
+	mutex       sync.Mutex
+	conn        *sql.Conn
+	lastChecked time.Time
+}
+
+// NewLeader creates an election for the named locks. id identifies this
+// instance to the others.
+func NewLeader(db *sql.DB, id string, names []string) *Leader {
+	// The locks are always taken in the same order, so two instances
+	// campaigning for overlapping names cannot each hold a part of them.
+	sorted := append([]string{}, names...)
+	sort.Strings(sorted)
+
+	unique := sorted[:0]
+	for i, name := range sorted {
+		if i == 0 || name != sorted[i-1] {
+			unique = append(unique, name)
+		}
+	}
+
+	return &Leader{db: db, id: id, names: unique, lastChecked: time.Now()}
+}
+
+// Campaign blocks until this instance holds every lock or ctx is cancelled.
+// The returned context is cancelled with ErrLeadershipLost as its cause when
+// leadership is lost. Resign has to be called once the work done as leader has
+// stopped.
+func (l *Leader) Campaign(ctx context.Context) (context.Context, error) {
+	ticker := time.NewTicker(leaderCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		acquired, err := l.tryAcquire(ctx)
+		if err != nil {
+			fmt.Printf("leader election failed: %v\n", err)
+		}
+		l.checked()
+		if acquired {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	leaderCtx, cancel := context.WithCancelCause(ctx)
+	go l.watch(leaderCtx, cancel)
+	return leaderCtx, nil
+}
+
+// Resign releases the locks.
+func (l *Leader) Resign() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.conn != nil {
+		// Closing a connection that holds a session lock would return it to
+		// the pool with the lock, so it is released first and the connection
+		// is dropped if that fails.
+		if _, err := l.conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock_all()"); err != nil {
+			l.conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+		l.conn.Close()
+		l.conn = nil
+	}
+}
+
+// IsLeader reports whether this instance currently holds the locks.
+func (l *Leader) IsLeader() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.conn != nil
+}
+
+func (l *Leader) ID() string {
+	return l.id
+}
+
+// LastChecked returns when the election last made progress, so a stuck
+// standby can be told apart from a waiting one.
+func (l *Leader) LastChecked() time.Time {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.lastChecked
+}
+
+// Holders returns the id of the instance holding each lock by name, with an
+// empty string for the ones nobody holds.
+func (l *Leader) Holders(ctx context.Context) (map[string]string, error) {
+	names := make(map[int64]string, len(l.names))
+	keys := make([]int64, 0, len(l.names))
+	holders := make(map[string]string, len(l.names))
+	for _, name := range l.names {
+		names[lockKey(name)] = name
+		keys = append(keys, lockKey(name))
+		holders[name] = ""
+	}
+
+	rows, err := l.db.QueryContext(ctx, `SELECT ((l.classid::bigint << 32) | l.objid::bigint), a.application_name FROM pg_locks l
+		JOIN pg_stat_activity a ON a.pid = l.pid
+		WHERE l.locktype = 'advisory' AND l.granted AND l.objsubid = 1
+			AND l.database = (SELECT oid FROM pg_database WHERE datname = current_database())
+			AND ((l.classid::bigint << 32) | l.objid::bigint) = ANY($1)`, pq.Array(keys))
+	if err != nil {
+		return nil, fmt.Errorf("error getting the lock holders: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			key    int64
+			holder string
+		)
+		if err := rows.Scan(&key, &holder); err != nil {
+			return nil, fmt.Errorf("error scanning lock holder: %v", err)
+		}
+		holders[names[key]] = holder
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting the lock holders: %v", err)
+	}
+
+	return holders, nil
+}
+
+func (l *Leader) tryAcquire(ctx context.Context) (bool, error) {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return false, fmt.Errorf("error opening the leader connection: %v", err)
+	}
+
+	acquired, err := l.lock(ctx, conn)
+	if err != nil || !acquired {
+		conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		conn.Close()
+		return false, err
+	}
+
+	l.mutex.Lock()
+	l.conn = conn
+	l.mutex.Unlock()
+	return true, nil
+}
+
+func (l *Leader) lock(ctx context.Context, conn *sql.Conn) (bool, error) {
+	// Other instances see who holds the lock through the application name.
+	if _, err := conn.ExecContext(ctx, "SELECT set_config('application_name', $1, false)", l.id); err != nil {
+		return false, fmt.Errorf("error setting the instance id: %v", err)
+	}
+
+	// Locks taken before one that is held elsewhere are released with the
+	// connection by tryAcquire, so no lock is kept unless all of them are.
+	for _, name := range l.names {
+		var acquired bool
+		if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", lockKey(name)).Scan(&acquired); err != nil {
+			return false, fmt.Errorf("error taking lock %s: %v", name, err)
+		}
+		if !acquired {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// watch cancels the leader context once the connection holding the lock
+// stops answering, as Postgres has released them by then.
+func (l *Leader) watch(ctx context.Context, cancel context.CancelCauseFunc) {
+	defer cancel(nil)
+
+	ticker := time.NewTicker(leaderCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		l.mutex.Lock()
+		conn := l.conn
+		l.mutex.Unlock()
+		if conn == nil {
+			return
+		}
+
+		pingCtx, cancelPing := context.WithTimeout(ctx, leaderCheckInterval)
+		err := conn.PingContext(pingCtx)
+		cancelPing()
+		if err != nil {
+			if ctx.Err() == nil {
+				fmt.Printf("lost leadership: %v\n", err)
+				cancel(ErrLeadershipLost)
+			}
+			return
+		}
+		l.checked()
+	}
+}
+
+func (l *Leader) checked() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.lastChecked = time.Now()
+}
+
+// lockKey maps a lock name onto the 64 bit advisory lock key space.
+func lockKey(name string) int64 {
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "leader %s", name)
+	return int64(hash.Sum64())
+}
@@ -0,0 +1,258 @@
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"erc-721-checks/internal/listener"
+	"erc-721-checks/internal/models"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	// subscriberBuffer is how many events a client may fall behind before it
+	// is disconnected. Clients resume from their last event when they
+	// reconnect, so nothing is lost.
+	subscriberBuffer = 256
+	// resumePageSize is how many stored events are loaded at once when a
+	// client resumes.
+	resumePageSize = 500
+	// keepaliveInterval keeps idle connections from being closed by proxies.
+	keepaliveInterval = 30 * time.Second
+)
+
+// Hub is a listener sink that streams every event it receives to the
+// connected feed clients. Clients resume from an event id by replaying the
+// stored events after it before switching to the live events.
+type Hub struct {
+	repository     *models.EventRepository
+	labels         map[common.Address]string
+	events         listener.Filter
+	allowedOrigins []string
+
+	mutex       sync.Mutex
+	subscribers map[*subscriber]struct{}
+	closed      bool
+}
+
+type subscriber struct {
+	events chan listener.Event
+}
+
+// NewHub creates a hub resuming clients from the events in repository. labels
+// restores the contract labels of resumed events and events is the listener's
+// filter, which resumed events have to pass like live ones. allowedOrigins
+// lists the origins browsers may connect from besides the feed's own, "*"
+// allows any.
+func NewHub(repository *models.EventRepository, labels map[common.Address]string, events listener.Filter, allowedOrigins []string) *Hub {
+	return &Hub{
+		repository:     repository,
+		labels:         labels,
+		events:         events,
+		allowedOrigins: allowedOrigins,
+		subscribers:    make(map[*subscriber]struct{}),
+	}
+}
+
+// Send hands the event to every client without blocking the listener.
+// Clients that are too far behind are disconnected.
+func (h *Hub) Send(event listener.Event) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for s := range h.subscribers {
+		select {
+		case s.events <- event:
+		default:
+			delete(h.subscribers, s)
+			close(s.events)
+		}
+	}
+
+	return nil
+}
+
+// Close disconnects every client and refuses new ones.
+func (h *Hub) Close() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.closed = true
+	for s := range h.subscribers {
+		delete(h.subscribers, s)
+		close(s.events)
+	}
+}
+
+func (h *Hub) subscribe() *subscriber {
+	s := &subscriber{events: make(chan listener.Event, subscriberBuffer)}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.closed {
+		close(s.events)
+	} else {
+		h.subscribers[s] = struct{}{}
+	}
+	return s
+}
+
+func (h *Hub) unsubscribe(s *subscriber) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if _, ok := h.subscribers[s]; ok {
+		delete(h.subscribers, s)
+		close(s.events)
+	}
+}
+
+// stream sends the events matching filter until ctx is cancelled, the client
+// falls behind or send fails. With since set, the stored events after that id
+// are sent first. ping is called every keepaliveInterval.
+func (h *Hub) stream(ctx context.Context, filter Filter, since *int64, send func(listener.Event) error, ping func() error) error {
+	var (
+		lastID int64
+		err    error
+	)
+	if since != nil {
+		// Most of the backlog is sent before subscribing so a long resume does
+		// not overflow the live buffer, and once more afterwards for the events
+		// stored in between.
+		if lastID, err = h.resume(ctx, *since, filter, send); err != nil {
+			return err
+		}
+	}
+
+	s := h.subscribe()
+	defer h.unsubscribe(s)
+
+	if since != nil {
+		if lastID, err = h.resume(ctx, lastID, filter, send); err != nil {
+			return err
+		}
+	}
+
+	keepalive := time.NewTicker(keepaliveInterval)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-s.events:
+			if !ok {
+				return nil
+			}
+			// Events already sent while resuming come through again.
+			if event.ID != 0 && event.ID <= lastID {
+				continue
+			}
+			if event.ID != 0 {
+				lastID = event.ID
+			}
+			if !filter.match(event) {
+				continue
+			}
+			if err := send(event); err != nil {
+				return err
+			}
+		case <-keepalive.C:
+			if err := ping(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// resume sends the stored events after id and returns the id of the last one.
+func (h *Hub) resume(ctx context.Context, id int64, filter Filter, send func(listener.Event) error) (int64, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return id, err
+		}
+
+		stored, err := h.repository.GetEventsAfter(id, resumePageSize)
+		if err != nil {
+			return id, err
+		}
+
+		for _, storedEvent := range stored {
+			event := listener.StoredEvent(storedEvent, h.labels[common.HexToAddress(storedEvent.ContractAddress)])
+			id = event.ID
+			if !h.events.Match(event) || !filter.match(event) {
+				continue
+			}
+			if err := send(event); err != nil {
+				return id, err
+			}
+		}
+
+		if len(stored) < resumePageSize {
+			return id, nil
+		}
+	}
+}
+
+// Filter selects the events a client receives. An event matches Addresses
+// when it was emitted by or involves one of them, and TokenIDs when it is
+// about one of them. Empty lists match everything, and Reorg events are always
+// sent.
+type Filter struct {
+	Addresses []common.Address
+	TokenIDs  []*big.Int
+}
+
+func (f Filter) match(event listener.Event) bool {
+	if event.Name == listener.ReorgEvent || (len(f.Addresses) == 0 && len(f.TokenIDs) == 0) {
+		return true
+	}
+
+	// Live events carry typed data and resumed ones raw JSON, so both are
+	// compared in their JSON form.
+	var fields map[string]interface{}
+	if data, err := json.Marshal(event.Data); err == nil {
+		json.Unmarshal(data, &fields)
+	}
+
+	if len(f.Addresses) > 0 && !f.matchAddress(event.Contract, fields) {
+		return false
+	}
+
+	if len(f.TokenIDs) > 0 {
+		value, _ := fields["tokenId"].(string)
+		tokenID, ok := new(big.Int).SetString(value, 10)
+		if !ok {
+			return false
+		}
+		for _, id := range f.TokenIDs {
+			if id.Cmp(tokenID) == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+func (f Filter) matchAddress(contract common.Address, fields map[string]interface{}) bool {
+	for _, address := range f.Addresses {
+		if address == contract {
+			return true
+		}
+		for _, value := range fields {
+			if s, ok := value.(string); ok && len(s) == 2*common.AddressLength+2 && strings.EqualFold(s, address.Hex()) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
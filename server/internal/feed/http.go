@@ -0,0 +1,186 @@
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"erc-721-checks/internal/listener"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gorilla/websocket"
+)
+
+// writeTimeout bounds every write to a client so a stalled connection does
+// not hold its subscription forever.
+const writeTimeout = 10 * time.Second
+
+// ServeSSE streams events as Server-Sent Events. Every event carries its id,
+// so a reconnecting EventSource resumes through the Last-Event-ID header.
+func (h *Hub) ServeSSE(w http.ResponseWriter, r *http.Request) {
+	filter, since, err := parseRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		lastEventID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid Last-Event-ID %s", id), http.StatusBadRequest)
+			return
+		}
+		since = &lastEventID
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	if origin := r.Header.Get("Origin"); origin != "" && h.allowOrigin(origin, r.Host) {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	controller := http.NewResponseController(w)
+	write := func(message string) error {
+		controller.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err := fmt.Fprint(w, message); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	h.stream(r.Context(), filter, since, func(event listener.Event) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s event: %v", event.Name, err)
+		}
+
+		message := fmt.Sprintf("data: %s\n\n", data)
+		if event.ID != 0 {
+			message = fmt.Sprintf("id: %d\n%s", event.ID, message)
+		}
+		return write(message)
+	}, func() error {
+		return write(": keepalive\n\n")
+	})
+}
+
+// ServeWebSocket streams events as JSON text messages. Browsers cannot set
+// headers on a WebSocket, so a reconnecting client passes the id of the last
+// event it received as the since parameter.
+func (h *Hub) ServeWebSocket(w http.ResponseWriter, r *http.Request) {
+	filter, since, err := parseRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return origin == "" || h.allowOrigin(origin, r.Host)
+		},
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// Reading handles pings and close frames, and stops the stream once the
+	// client goes away. Clients have nothing to send.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	h.stream(ctx, filter, since, func(event listener.Event) error {
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		return conn.WriteJSON(event)
+	}, func() error {
+		return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout))
+	})
+
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""),
+		time.Now().Add(writeTimeout))
+}
+
+// allowOrigin accepts the feed's own origin and the configured ones.
+func (h *Hub) allowOrigin(origin, host string) bool {
+	if u, err := url.Parse(origin); err == nil && u.Host == host {
+		return true
+	}
+
+	for _, allowed := range h.allowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseRequest reads the address, tokenId and since query parameters.
+// address and tokenId may be repeated or comma separated.
+func parseRequest(r *http.Request) (Filter, *int64, error) {
+	query := r.URL.Query()
+
+	var filter Filter
+	for _, value := range splitValues(query["address"]) {
+		if !common.IsHexAddress(value) {
+			return Filter{}, nil, fmt.Errorf("invalid address %s", value)
+		}
+		filter.Addresses = append(filter.Addresses, common.HexToAddress(value))
+	}
+
+	for _, value := range splitValues(query["tokenId"]) {
+		tokenID, ok := new(big.Int).SetString(value, 10)
+		if !ok || tokenID.Sign() < 0 {
+			return Filter{}, nil, fmt.Errorf("invalid token ID %s", value)
+		}
+		filter.TokenIDs = append(filter.TokenIDs, tokenID)
+	}
+
+	var since *int64
+	if value := query.Get("since"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return Filter{}, nil, fmt.Errorf("invalid since %s", value)
+		}
+		since = &id
+	}
+
+	return filter, since, nil
+}
+
+func splitValues(values []string) []string {
+	var split []string
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				split = append(split, part)
+			}
+		}
+	}
+	return split
+}
@@ -0,0 +1,227 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"erc-721-checks/internal/database"
+	"erc-721-checks/internal/ipfs"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+
+	checkTimeout = 5 * time.Second
+)
+
+// Check inspects a single dependency. Details are reported even when the
+// check fails.
+type Check func(ctx context.Context) (details map[string]interface{}, err error)
+
+type Result struct {
+	Status  string                 `json:"status"`
+	Error   string                 `json:"error,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Handler runs every check concurrently and responds with a Report, using
+// 503 when any of them failed.
+func Handler(checks map[string]Check) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		defer cancel()
+
+		report := Report{Status: StatusOK, Checks: make(map[string]Result, len(checks))}
+
+		var (
+			mutex     sync.Mutex
+			waitGroup sync.WaitGroup
+		)
+		for name, check := range checks {
+			waitGroup.Add(1)
+			go func(name string, check Check) {
+				defer waitGroup.Done()
+
+				details, err := check(ctx)
+				result := Result{Status: StatusOK, Details: details}
+				if err != nil {
+					result.Status, result.Error = StatusFail, err.Error()
+				}
+
+				mutex.Lock()
+				defer mutex.Unlock()
+				report.Checks[name] = result
+				if err != nil {
+					report.Status = StatusFail
+				}
+			}(name, check)
+		}
+		waitGroup.Wait()
+
+		w.Header().Set("Content-Type", "application/json")
+		if report.Status != StatusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+}
+
+func Database(db *sql.DB) Check {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		if err := db.PingContext(ctx); err != nil {
+			return nil, fmt.Errorf("failed to ping database: %v", err)
+		}
+		return nil, nil
+	}
+}
+
+func IPFS(client *ipfs.Client) Check {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		if err := client.Ping(ctx); err != nil {
+			return nil, fmt.Errorf("gateway unreachable: %v", err)
+		}
+		return nil, nil
+	}
+}
+
+// Chain checks the provider over a client of its own, so health checks never
+// race with the listener replacing its connection. The client is redialed
+// after any failure.
+type Chain struct {
+	dial   func(ctx context.Context) (*ethclient.Client, error)
+	mutex  sync.Mutex
+	client *ethclient.Client
+}
+
+func NewChain(dial func(ctx context.Context) (*ethclient.Client, error)) *Chain {
+	return &Chain{dial: dial}
+}
+
+func (c *Chain) head(ctx context.Context) (*types.Header, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.client == nil {
+		client, err := c.dial(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.client = client
+	}
+
+	header, err := c.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		c.client.Close()
+		c.client = nil
+		return nil, fmt.Errorf("failed to retrieve head block: %v", err)
+	}
+
+	return header, nil
+}
+
+// Provider fails when the provider is unreachable or its head block is older
+// than maxHeadAge.
+func (c *Chain) Provider(maxHeadAge time.Duration) Check {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		header, err := c.head(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		age := time.Since(time.Unix(int64(header.Time), 0)).Round(time.Second)
+		details := map[string]interface{}{
+			"headBlock": header.Number.Uint64(),
+			"headAge":   age.String(),
+		}
+		if age > maxHeadAge {
+			return details, fmt.Errorf("head block is %s old", age)
+		}
+
+		return details, nil
+	}
+}
+
+// Lag fails while the listener is not live or more than maxLag blocks behind
+// the head. progress reports the last processed block and whether the
+// listener is live.
+func (c *Chain) Lag(progress func() (uint64, bool), maxLag uint64) Check {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		header, err := c.head(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		head := header.Number.Uint64()
+		processed, live := progress()
+
+		var lag uint64
+		if head > processed {
+			lag = head - processed
+		}
+
+		details := map[string]interface{}{
+			"headBlock":      head,
+			"processedBlock": processed,
+			"lag":            lag,
+			"live":           live,
+		}
+		if !live {
+			return details, fmt.Errorf("listener is not live")
+		}
+		if lag > maxLag {
+			return details, fmt.Errorf("listener is %d blocks behind", lag)
+		}
+
+		return details, nil
+	}
+}
+
+// Activity fails when the listener loop has not made progress for timeout,
+// meaning it is stuck rather than just behind.
+func Activity(lastActive func() time.Time, timeout time.Duration) Check {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		idle := time.Since(lastActive()).Round(time.Second)
+		details := map[string]interface{}{"idle": idle.String()}
+		if idle > timeout {
+			return details, fmt.Errorf("listener made no progress for %s", idle)
+		}
+		return details, nil
+	}
+}
+
+// Leadership reports whether this instance is the leader and which instance
+// holds the lock of each contract. It fails when the election made no progress
+// for timeout.
+func Leadership(leader *database.Leader, timeout time.Duration) Check {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		details := map[string]interface{}{
+			"instance": leader.ID(),
+			"leader":   leader.IsLeader(),
+		}
+
+		holders, err := leader.Holders(ctx)
+		if err != nil {
+			return details, err
+		}
+		details["holders"] = holders
+
+		if idle := time.Since(leader.LastChecked()).Round(time.Second); idle > timeout {
+			return details, fmt.Errorf("leader election made no progress for %s", idle)
+		}
+		return details, nil
+	}
+}
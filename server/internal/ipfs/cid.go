@@ -0,0 +1,142 @@
+package ipfs
+
+import (
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const (
+	codecRaw    = 0x55
+	codecDagPB  = 0x70
+	hashSHA256  = 0x12
+	sha256Size  = 32
+	base58Chars = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+)
+
+var base32Lower = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// cid is the subset of content identifiers the client can verify: sha2-256
+// hashed dag-pb or raw blocks, as produced by `ipfs add`.
+type cid struct {
+	version int
+	codec   uint64
+	digest  []byte
+}
+
+func parseCID(value string) (cid, error) {
+	switch {
+	case strings.HasPrefix(value, "Qm") && len(value) == 46:
+		multihash, err := base58Decode(value)
+		if err != nil {
+			return cid{}, err
+		}
+		digest, err := decodeMultihash(multihash)
+		if err != nil {
+			return cid{}, err
+		}
+		return cid{version: 0, codec: codecDagPB, digest: digest}, nil
+	case strings.HasPrefix(value, "b"):
+		binaryCID, err := base32Lower.DecodeString(value[1:])
+		if err != nil {
+			return cid{}, fmt.Errorf("%w: invalid base32 CID %s", ErrUnsupported, value)
+		}
+		return decodeBinaryCID(binaryCID)
+	default:
+		return cid{}, fmt.Errorf("%w: CID encoding of %s", ErrUnsupported, value)
+	}
+}
+
+// decodeBinaryCID decodes the CIDs found in dag-pb links.
+func decodeBinaryCID(value []byte) (cid, error) {
+	if len(value) == sha256Size+2 && value[0] == hashSHA256 && value[1] == sha256Size {
+		return cid{version: 0, codec: codecDagPB, digest: value[2:]}, nil
+	}
+
+	version, n := binary.Uvarint(value)
+	if n <= 0 || version != 1 {
+		return cid{}, fmt.Errorf("%w: CID version", ErrUnsupported)
+	}
+	value = value[n:]
+
+	codec, n := binary.Uvarint(value)
+	if n <= 0 {
+		return cid{}, fmt.Errorf("%w: malformed CID codec", ErrUnsupported)
+	}
+	if codec != codecRaw && codec != codecDagPB {
+		return cid{}, fmt.Errorf("%w: CID codec 0x%x", ErrUnsupported, codec)
+	}
+
+	digest, err := decodeMultihash(value[n:])
+	if err != nil {
+		return cid{}, err
+	}
+
+	return cid{version: 1, codec: codec, digest: digest}, nil
+}
+
+func decodeMultihash(value []byte) ([]byte, error) {
+	code, n := binary.Uvarint(value)
+	if n <= 0 || code != hashSHA256 {
+		return nil, fmt.Errorf("%w: multihash function", ErrUnsupported)
+	}
+	value = value[n:]
+
+	length, n := binary.Uvarint(value)
+	if n <= 0 || length != sha256Size || len(value[n:]) != sha256Size {
+		return nil, fmt.Errorf("%w: multihash length", ErrUnsupported)
+	}
+
+	return value[n:], nil
+}
+
+func (c cid) String() string {
+	multihash := append([]byte{hashSHA256, sha256Size}, c.digest...)
+	if c.version == 0 {
+		return base58Encode(multihash)
+	}
+
+	binaryCID := binary.AppendUvarint([]byte{1}, c.codec)
+	return "b" + base32Lower.EncodeToString(append(binaryCID, multihash...))
+}
+
+func base58Decode(value string) ([]byte, error) {
+	number := new(big.Int)
+	radix := big.NewInt(58)
+	for _, char := range value {
+		index := strings.IndexRune(base58Chars, char)
+		if index < 0 {
+			return nil, fmt.Errorf("%w: invalid base58 CID %s", ErrUnsupported, value)
+		}
+		number.Mul(number, radix)
+		number.Add(number, big.NewInt(int64(index)))
+	}
+
+	leadingZeros := len(value) - len(strings.TrimLeft(value, "1"))
+	return append(make([]byte, leadingZeros), number.Bytes()...), nil
+}
+
+func base58Encode(value []byte) string {
+	number := new(big.Int).SetBytes(value)
+	radix := big.NewInt(58)
+	remainder := new(big.Int)
+
+	var encoded []byte
+	for number.Sign() > 0 {
+		number.DivMod(number, radix, remainder)
+		encoded = append(encoded, base58Chars[remainder.Int64()])
+	}
+	for _, b := range value {
+		if b != 0 {
+			break
+		}
+		encoded = append(encoded, base58Chars[0])
+	}
+
+	for i, j := 0, len(encoded)-1; i < j; i, j = i+1, j-1 {
+		encoded[i], encoded[j] = encoded[j], encoded[i]
+	}
+	return string(encoded)
+}
@@ -0,0 +1,174 @@
+package ipfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+const (
+	// emptyFileCID is `ipfs add` of an empty file, whose block is emptyFileBlock.
+	emptyFileCID    = "QmbFMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1AwQH"
+	emptyFileDigest = "bfccda787baba32b59c78450ac3d20b633360b43992c77289f9ed46d843561e6"
+	// emptyRawCID is the raw block of zero bytes, hashed to sha2-256("").
+	emptyRawCID    = "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku"
+	emptyRawDigest = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	// directoryCID and directoryCIDv1 are the same node in both versions.
+	directoryCID    = "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+	directoryCIDv1  = "bafybeie5nqv6kd3qnfjupgvz34woh3oksc3iau6abmyajn7qvtf6d2ho34"
+	directoryDigest = "9d6c2be50f706953479ab9df2ce3edca90b68053c00b3004b7f0accbe1e8eedf"
+)
+
+// emptyFileBlock is a dag-pb node whose data is a UnixFS file of size 0.
+var emptyFileBlock = []byte{0x0a, 0x04, 0x08, 0x02, 0x18, 0x00}
+
+func TestParseCID(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		version int
+		codec   uint64
+		digest  string
+		err     error
+	}{
+		{name: "v0 file", value: emptyFileCID, version: 0, codec: codecDagPB, digest: emptyFileDigest},
+		{name: "v0 directory", value: directoryCID, version: 0, codec: codecDagPB, digest: directoryDigest},
+		{name: "v1 dag-pb", value: directoryCIDv1, version: 1, codec: codecDagPB, digest: directoryDigest},
+		{name: "v1 raw", value: emptyRawCID, version: 1, codec: codecRaw, digest: emptyRawDigest},
+		{name: "empty", value: "", err: ErrUnsupported},
+		{name: "base58 without Qm", value: "zdj7WWeQ43G6JJvLWQWZpyHuAMq6uYWRjkBXFad11vE2LHhQ7", err: ErrUnsupported},
+		{name: "v0 truncated", value: emptyFileCID[:45], err: ErrUnsupported},
+		{name: "v0 invalid base58", value: "Qm0FMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1AwQH", err: ErrUnsupported},
+		{name: "v0 not a multihash", value: "Qm11111111111111111111111111111111111111111111", err: ErrUnsupported},
+		{name: "v1 truncated", value: directoryCIDv1[:len(directoryCIDv1)-2], err: ErrUnsupported},
+		{name: "v1 uppercase base32", value: "B" + directoryCIDv1[1:], err: ErrUnsupported},
+		{name: "v1 invalid base32", value: "b1" + directoryCIDv1[2:], err: ErrUnsupported},
+		{name: "v1 prefix only", value: "b", err: ErrUnsupported},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id, err := parseCID(test.value)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("parseCID(%q) error = %v, want %v", test.value, err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseCID(%q) error = %v", test.value, err)
+			}
+
+			if id.version != test.version || id.codec != test.codec {
+				t.Errorf("parseCID(%q) = version %d codec 0x%x, want version %d codec 0x%x", test.value, id.version, id.codec, test.version, test.codec)
+			}
+			if digest := hex.EncodeToString(id.digest); digest != test.digest {
+				t.Errorf("parseCID(%q) digest = %s, want %s", test.value, digest, test.digest)
+			}
+			if id.String() != test.value {
+				t.Errorf("parseCID(%q).String() = %s", test.value, id.String())
+			}
+		})
+	}
+}
+
+func TestDecodeBinaryCID(t *testing.T) {
+	digest, _ := hex.DecodeString(directoryDigest)
+	multihash := append([]byte{hashSHA256, sha256Size}, digest...)
+	v1 := append([]byte{1, codecDagPB}, multihash...)
+
+	tests := []struct {
+		name    string
+		value   []byte
+		version int
+		err     error
+	}{
+		{name: "v0 multihash", value: multihash, version: 0},
+		{name: "v1", value: v1, version: 1},
+		{name: "empty", value: nil, err: ErrUnsupported},
+		{name: "version only", value: v1[:1], err: ErrUnsupported},
+		{name: "no digest", value: v1[:4], err: ErrUnsupported},
+		{name: "truncated digest", value: v1[:len(v1)-1], err: ErrUnsupported},
+		{name: "trailing bytes", value: append(append([]byte{}, v1...), 0), err: ErrUnsupported},
+		{name: "version 2", value: append([]byte{2}, v1[1:]...), err: ErrUnsupported},
+		{name: "unknown codec", value: append([]byte{1, 0x71}, multihash...), err: ErrUnsupported},
+		{name: "unterminated codec varint", value: []byte{1, 0x80}, err: ErrUnsupported},
+		{name: "sha1 multihash", value: append([]byte{1, codecRaw, 0x11, 20}, make([]byte, 20)...), err: ErrUnsupported},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id, err := decodeBinaryCID(test.value)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("decodeBinaryCID(%x) error = %v, want %v", test.value, err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeBinaryCID(%x) error = %v", test.value, err)
+			}
+			if id.version != test.version || !bytes.Equal(id.digest, digest) {
+				t.Errorf("decodeBinaryCID(%x) = version %d digest %x", test.value, id.version, id.digest)
+			}
+		})
+	}
+}
+
+func TestDecodeFileNode(t *testing.T) {
+	link := append([]byte{hashSHA256, sha256Size}, make([]byte, sha256Size)...)
+	// A file with inline data "hi" and one link, as field 2 (Links) holding
+	// field 1 (Hash).
+	withLink := append([]byte{0x12, byte(len(link) + 2), 0x0a, byte(len(link))}, link...)
+	withLink = append(withLink, 0x0a, 0x06, 0x08, 0x02, 0x12, 0x02, 'h', 'i')
+
+	tests := []struct {
+		name  string
+		block []byte
+		data  string
+		links int
+		err   error
+	}{
+		{name: "empty file", block: emptyFileBlock},
+		{name: "file with link", block: withLink, data: "hi", links: 1},
+		{name: "raw node", block: []byte{0x0a, 0x04, 0x08, 0x00, 0x12, 0x00}},
+		{name: "directory", block: []byte{0x0a, 0x02, 0x08, 0x01}, err: ErrUnsupported},
+		{name: "truncated data", block: emptyFileBlock[:4], err: ErrInvalidContent},
+		{name: "truncated key", block: []byte{0x80}, err: ErrInvalidContent},
+		{name: "truncated varint", block: []byte{0x0a, 0x02, 0x08, 0x80}, err: ErrInvalidContent},
+		{name: "truncated fixed64", block: []byte{0x09, 0x00, 0x00}, err: ErrInvalidContent},
+		{name: "unknown wire type", block: []byte{0x0b}, err: ErrInvalidContent},
+		{name: "invalid link", block: []byte{0x12, 0x03, 0x0a, 0x01, 0x00}, err: ErrUnsupported},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, links, err := decodeFileNode(test.block)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("decodeFileNode(%x) error = %v, want %v", test.block, err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeFileNode(%x) error = %v", test.block, err)
+			}
+			if string(data) != test.data || len(links) != test.links {
+				t.Errorf("decodeFileNode(%x) = %q with %d links, want %q with %d", test.block, data, len(links), test.data, test.links)
+			}
+		})
+	}
+}
+
+func TestEmptyFileBlockMatchesCID(t *testing.T) {
+	id, err := parseCID(emptyFileCID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(emptyFileBlock)
+	if !bytes.Equal(digest[:], id.digest) {
+		t.Fatalf("block hashes to %x, want %x", digest, id.digest)
+	}
+}
@@ -0,0 +1,252 @@
+package ipfs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	requestTimeout = 10 * time.Second
+	maxBlockSize   = 2 << 20
+	maxContentSize = 1 << 20
+	maxLinkDepth   = 4
+
+	unixfsRaw  = 0
+	unixfsFile = 2
+)
+
+var (
+	// ErrInvalidContent means the gateway returned bytes that do not hash to
+	// the requested CID. Retrying will not help.
+	ErrInvalidContent = errors.New("content does not match its CID")
+	// ErrUnsupported means the URI or content cannot be verified by this client.
+	ErrUnsupported = errors.New("unsupported IPFS content")
+)
+
+// Client fetches files through an HTTP gateway without trusting it: every
+// block is requested raw and checked against its CID before it is used.
+type Client struct {
+	gatewayURL string
+	httpClient *http.Client
+}
+
+func NewClient(gatewayURL string) *Client {
+	return &Client{
+		gatewayURL: strings.TrimRight(gatewayURL, "/"),
+		httpClient: &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// Fetch returns the verified content behind an ipfs://<cid> URI.
+func (c *Client) Fetch(ctx context.Context, uri string) ([]byte, error) {
+	reference := strings.TrimPrefix(uri, "ipfs://")
+	if index := strings.Index(reference, "/ipfs/"); index >= 0 {
+		reference = reference[index+len("/ipfs/"):]
+	}
+	if reference == uri || strings.ContainsAny(reference, "/?#") {
+		return nil, fmt.Errorf("%w: uri %s", ErrUnsupported, uri)
+	}
+
+	id, err := parseCID(reference)
+	if err != nil {
+		return nil, err
+	}
+
+	var content bytes.Buffer
+	if err := c.fetchFile(ctx, id, &content, 0); err != nil {
+		return nil, err
+	}
+
+	return content.Bytes(), nil
+}
+
+// emptyDirectoryCID is the well-known CID of an empty UnixFS directory, which
+// every gateway serves without going to the network.
+const emptyDirectoryCID = "QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"
+
+// Ping checks that the gateway is reachable and serves verifiable blocks.
+func (c *Client) Ping(ctx context.Context) error {
+	id, err := parseCID(emptyDirectoryCID)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.fetchBlock(ctx, id)
+	return err
+}
+
+func (c *Client) fetchFile(ctx context.Context, id cid, content *bytes.Buffer, depth int) error {
+	if depth > maxLinkDepth {
+		return fmt.Errorf("%w: file is nested too deeply", ErrUnsupported)
+	}
+
+	block, err := c.fetchBlock(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if id.codec == codecRaw {
+		content.Write(block)
+	} else {
+		data, links, err := decodeFileNode(block)
+		if err != nil {
+			return err
+		}
+
+		content.Write(data)
+		for _, link := range links {
+			if err := c.fetchFile(ctx, link, content, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	if content.Len() > maxContentSize {
+		return fmt.Errorf("%w: file is larger than %d bytes", ErrUnsupported, maxContentSize)
+	}
+
+	return nil
+}
+
+func (c *Client) fetchBlock(ctx context.Context, id cid) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/ipfs/%s?format=raw", c.gatewayURL, id), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	request.Header.Set("Accept", "application/vnd.ipld.raw")
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch block %s: %v", id, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch block %s: gateway responded with %s", id, response.Status)
+	}
+
+	block, err := io.ReadAll(io.LimitReader(response.Body, maxBlockSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block %s: %v", id, err)
+	}
+	if len(block) > maxBlockSize {
+		return nil, fmt.Errorf("%w: block %s is too large", ErrUnsupported, id)
+	}
+
+	digest := sha256.Sum256(block)
+	if !bytes.Equal(digest[:], id.digest) {
+		return nil, fmt.Errorf("%w: block %s", ErrInvalidContent, id)
+	}
+
+	return block, nil
+}
+
+// decodeFileNode reads a dag-pb node holding a UnixFS file and returns its
+// inline data and the CIDs of the blocks that follow it.
+func decodeFileNode(block []byte) ([]byte, []cid, error) {
+	var (
+		nodeData []byte
+		links    []cid
+	)
+	err := decodeProtobuf(block, func(field uint64, value []byte, _ uint64) error {
+		switch field {
+		case 1:
+			nodeData = value
+		case 2:
+			return decodeProtobuf(value, func(field uint64, value []byte, _ uint64) error {
+				if field != 1 {
+					return nil
+				}
+				link, err := decodeBinaryCID(value)
+				if err != nil {
+					return err
+				}
+				links = append(links, link)
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		fileType uint64
+		fileData []byte
+	)
+	err = decodeProtobuf(nodeData, func(field uint64, value []byte, number uint64) error {
+		switch field {
+		case 1:
+			fileType = number
+		case 2:
+			fileData = value
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if fileType != unixfsFile && fileType != unixfsRaw {
+		return nil, nil, fmt.Errorf("%w: UnixFS node type %d", ErrUnsupported, fileType)
+	}
+
+	return fileData, links, nil
+}
+
+// decodeProtobuf calls fn for every varint and length-delimited field of a
+// protobuf message. Fixed size fields are skipped.
+func decodeProtobuf(message []byte, fn func(field uint64, value []byte, number uint64) error) error {
+	for len(message) > 0 {
+		key, n := binary.Uvarint(message)
+		if n <= 0 {
+			return fmt.Errorf("%w: malformed protobuf key", ErrInvalidContent)
+		}
+		message = message[n:]
+
+		field, wireType := key>>3, key&7
+		switch wireType {
+		case 0:
+			number, n := binary.Uvarint(message)
+			if n <= 0 {
+				return fmt.Errorf("%w: malformed protobuf varint", ErrInvalidContent)
+			}
+			message = message[n:]
+			if err := fn(field, nil, number); err != nil {
+				return err
+			}
+		case 1, 5:
+			size := 8
+			if wireType == 5 {
+				size = 4
+			}
+			if len(message) < size {
+				return fmt.Errorf("%w: truncated protobuf field", ErrInvalidContent)
+			}
+			message = message[size:]
+		case 2:
+			length, n := binary.Uvarint(message)
+			if n <= 0 || uint64(len(message)-n) < length {
+				return fmt.Errorf("%w: truncated protobuf field", ErrInvalidContent)
+			}
+			value := message[n : n+int(length)]
+			message = message[n+int(length):]
+			if err := fn(field, value, 0); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: unknown protobuf wire type %d", ErrInvalidContent, wireType)
+		}
+	}
+
+	return nil
+}
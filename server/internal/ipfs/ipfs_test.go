@@ -0,0 +1,98 @@
+package ipfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// gateway serves the given blocks by CID, like a gateway asked for
+// ?format=raw, and 404 for every other CID.
+func gateway(t *testing.T, blocks map[string][]byte) *Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		block, ok := blocks[strings.TrimPrefix(r.URL.Path, "/ipfs/")]
+		if !ok || r.URL.Query().Get("format") != "raw" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(block)
+	}))
+	t.Cleanup(server.Close)
+
+	return NewClient(server.URL + "/")
+}
+
+func rawCID(block []byte) cid {
+	digest := sha256.Sum256(block)
+	return cid{version: 1, codec: codecRaw, digest: digest[:]}
+}
+
+func TestFetch(t *testing.T) {
+	content := []byte(`{"name":"Check #1"}`)
+	raw := rawCID(content)
+
+	// A dag-pb file without data of its own that links to the raw block.
+	binary := append([]byte{1, codecRaw, hashSHA256, sha256Size}, raw.digest...)
+	node := append([]byte{0x12, byte(len(binary) + 2), 0x0a, byte(len(binary))}, binary...)
+	node = append(node, 0x0a, 0x02, 0x08, unixfsFile)
+	digest := sha256.Sum256(node)
+	file := cid{version: 0, codec: codecDagPB, digest: digest[:]}
+
+	tampered := rawCID([]byte("original"))
+
+	client := gateway(t, map[string][]byte{
+		raw.String():      content,
+		file.String():     node,
+		emptyFileCID:      emptyFileBlock,
+		tampered.String(): []byte("tampered"),
+	})
+
+	tests := []struct {
+		name    string
+		uri     string
+		content string
+		err     error
+	}{
+		{name: "raw block", uri: "ipfs://" + raw.String(), content: string(content)},
+		{name: "file with link", uri: "ipfs://" + file.String(), content: string(content)},
+		{name: "gateway path", uri: "https://example.com/ipfs/" + file.String(), content: string(content)},
+		{name: "empty file", uri: "ipfs://" + emptyFileCID},
+		{name: "content not matching its CID", uri: "ipfs://" + tampered.String(), err: ErrInvalidContent},
+		{name: "http uri", uri: "https://example.com/1.json", err: ErrUnsupported},
+		{name: "path inside a directory", uri: "ipfs://" + directoryCID + "/1.json", err: ErrUnsupported},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content, err := client.Fetch(context.Background(), test.uri)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("Fetch(%q) error = %v, want %v", test.uri, err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Fetch(%q) error = %v", test.uri, err)
+			}
+			if string(content) != test.content {
+				t.Errorf("Fetch(%q) = %q, want %q", test.uri, content, test.content)
+			}
+		})
+	}
+}
+
+func TestFetchUnavailableBlockIsRetryable(t *testing.T) {
+	client := gateway(t, nil)
+
+	_, err := client.Fetch(context.Background(), "ipfs://"+emptyFileCID)
+	if err == nil {
+		t.Fatal("Fetch succeeded without the block")
+	}
+	if errors.Is(err, ErrInvalidContent) || errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Fetch error = %v, want an error that is retried", err)
+	}
+}
@@ -0,0 +1,160 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"erc-721-checks/internal/metrics"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func (l *Listener) backfill(ctx context.Context) error {
+	head, err := l.client.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve head block number: %v", err)
+	}
+
+	// Reconnected sessions resume from the in-memory position, which may be
+	// ahead of the last stored checkpoints.
+	if !l.started {
+		for _, c := range l.contracts {
+			if err := l.loadStartBlock(ctx, c, head); err != nil {
+				return err
+			}
+		}
+		l.nextBlock = l.lowestNextBlock()
+		l.started = true
+	}
+
+	if l.nextBlock <= head {
+		fmt.Printf("Backfilling blocks %d to %d...\n\n", l.nextBlock, head)
+	}
+
+	for l.nextBlock <= head {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		end := l.nextBlock + l.config.ChunkSize - 1
+		if end > head {
+			end = head
+		}
+
+		if err := l.backfillRange(ctx, l.nextBlock, end); err != nil {
+			return err
+		}
+
+		if err := l.saveCheckpoint(end); err != nil {
+			return err
+		}
+		metrics.HeadLag.Set(float64(head - end))
+		l.touch()
+	}
+
+	return nil
+}
+
+// backfillRange fetches raw logs rather than using the generated
+// FilterTransfer iterator, which stops at the first log it cannot decode.
+// Contracts are only queried from their own next block onwards.
+func (l *Listener) backfillRange(ctx context.Context, start, end uint64) error {
+	var addresses []common.Address
+	for _, c := range l.contracts {
+		if c.nextBlock <= end {
+			addresses = append(addresses, c.Address)
+		}
+	}
+	if len(addresses) == 0 {
+		return nil
+	}
+
+	logs, err := l.client.FilterLogs(ctx,
+		l.filterQuery(new(big.Int).SetUint64(start), new(big.Int).SetUint64(end), addresses))
+	if err != nil {
+		return fmt.Errorf("failed to filter logs in blocks %d-%d: %v", start, end, err)
+	}
+
+	var events []Event
+	for _, vLog := range logs {
+		if c, ok := l.byAddress[vLog.Address]; ok && vLog.BlockNumber < c.nextBlock {
+			continue
+		}
+
+		if event, ok := l.prepareLog(vLog); ok {
+			events = append(events, event)
+		}
+	}
+
+	// The whole chunk is enriched at once to batch the calls.
+	if err := l.enricher.enrich(ctx, l.rpcClient, events); err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		if err := l.handleEvent(event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l *Listener) loadStartBlock(ctx context.Context, c *watchedContract, head uint64) error {
+	checkpoint, err := l.repositories.Checkpoints.GetCheckpoint(c.Address.Hex())
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case checkpoint != nil:
+		c.nextBlock = checkpoint.BlockNumber + 1
+	case c.StartBlock != nil:
+		c.nextBlock = *c.StartBlock
+	default:
+		c.nextBlock, err = l.deploymentBlock(ctx, c.Address, head)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deploymentBlock binary searches for the first block at which the contract
+// has code. This requires a provider that serves historical state.
+func (l *Listener) deploymentBlock(ctx context.Context, address common.Address, head uint64) (uint64, error) {
+	hasCode := func(blockNumber uint64) (bool, error) {
+		code, err := l.client.CodeAt(ctx, address, new(big.Int).SetUint64(blockNumber))
+		if err != nil {
+			return false, fmt.Errorf("failed to retrieve contract code at block %d: %v", blockNumber, err)
+		}
+		return len(code) > 0, nil
+	}
+
+	deployed, err := hasCode(head)
+	if err != nil {
+		return 0, err
+	}
+	if !deployed {
+		return 0, fmt.Errorf("no contract deployed at %s", address.Hex())
+	}
+
+	low, high := uint64(0), head
+	for low < high {
+		middle := low + (high-low)/2
+		deployed, err := hasCode(middle)
+		if err != nil {
+			return 0, err
+		}
+
+		if deployed {
+			high = middle
+		} else {
+			low = middle + 1
+		}
+	}
+
+	return low, nil
+}
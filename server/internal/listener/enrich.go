@@ -0,0 +1,203 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"erc-721-checks/internal/metrics"
+	"erc-721-checks/internal/utils"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// Logs arrive in chain order, so the caches only need to hold recent
+	// blocks and transactions to serve the other logs they emitted.
+	timestampCacheSize = 1024
+	receiptCacheSize   = 4096
+	// maxBatchSize stays below the batch limits of common providers.
+	maxBatchSize = 100
+	// Nodes behind a load balancer may not have the newest blocks yet, so
+	// missing blocks and receipts are fetched up to maxEnrichAttempts times.
+	maxEnrichAttempts   = 4
+	minEnrichRetryDelay = 500 * time.Millisecond
+	maxEnrichRetryDelay = 4 * time.Second
+)
+
+// Transaction describes the transaction an event was emitted in.
+// EffectiveGasPrice is in wei and missing on chains without EIP-1559.
+type Transaction struct {
+	From              common.Address `json:"from"`
+	GasUsed           uint64         `json:"gasUsed"`
+	EffectiveGasPrice string         `json:"effectiveGasPrice,omitempty"`
+}
+
+// receiptKey includes the block, so a transaction included again after a
+// reorg is looked up anew.
+type receiptKey struct {
+	block common.Hash
+	tx    common.Hash
+}
+
+// Only the fields used are decoded, which also keeps chains with extra header
+// or receipt fields working.
+type rpcBlock struct {
+	Timestamp hexutil.Uint64 `json:"timestamp"`
+}
+
+type rpcReceipt struct {
+	From              common.Address `json:"from"`
+	GasUsed           hexutil.Uint64 `json:"gasUsed"`
+	EffectiveGasPrice *hexutil.Big   `json:"effectiveGasPrice"`
+}
+
+// enricher adds block timestamps and transaction details to events. Blocks
+// and receipts missing from its caches are fetched in JSON-RPC batches.
+type enricher struct {
+	timestamps *lru.Cache[common.Hash, uint64]
+	receipts   *lru.Cache[receiptKey, Transaction]
+}
+
+func newEnricher() *enricher {
+	return &enricher{
+		timestamps: lru.NewCache[common.Hash, uint64](timestampCacheSize),
+		receipts:   lru.NewCache[receiptKey, Transaction](receiptCacheSize),
+	}
+}
+
+// enrich fills in Timestamp and Transaction of every event. Blocks and
+// receipts the provider does not return, e.g. a load balanced node behind the
+// head, are fetched again with backoff. Those still missing after
+// maxEnrichAttempts are left out and reported, so the events are recorded
+// without them. It only fails when ctx is cancelled.
+func (e *enricher) enrich(ctx context.Context, client *rpc.Client, events []Event) error {
+	var (
+		timestamps = make(map[common.Hash]uint64)
+		details    = make(map[receiptKey]Transaction)
+		blocks     = make(map[common.Hash]bool)
+		receipts   = make(map[receiptKey]bool)
+	)
+	for _, event := range events {
+		if _, known := timestamps[event.BlockHash]; !known && !blocks[event.BlockHash] {
+			if timestamp, ok := e.timestamps.Get(event.BlockHash); ok {
+				timestamps[event.BlockHash] = timestamp
+			} else {
+				blocks[event.BlockHash] = true
+			}
+		}
+
+		key := receiptKey{event.BlockHash, event.TxHash}
+		if _, known := details[key]; !known && !receipts[key] {
+			if transaction, ok := e.receipts.Get(key); ok {
+				details[key] = transaction
+			} else {
+				receipts[key] = true
+			}
+		}
+	}
+
+	for attempt := 0; len(blocks)+len(receipts) > 0 && attempt < maxEnrichAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(utils.Backoff(attempt-1, minEnrichRetryDelay, maxEnrichRetryDelay)):
+			}
+		}
+
+		if err := e.fetch(ctx, client, blocks, receipts, timestamps, details); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			fmt.Printf("%v\n", err)
+		}
+	}
+
+	for hash := range blocks {
+		metrics.EnrichmentsMissing.WithLabelValues("block").Inc()
+		fmt.Printf("Block %s not found, its events are recorded without a timestamp\n", hash.Hex())
+	}
+	for key := range receipts {
+		metrics.EnrichmentsMissing.WithLabelValues("receipt").Inc()
+		fmt.Printf("Receipt of transaction %s not found, its events are recorded without transaction details\n", key.tx.Hex())
+	}
+
+	for i := range events {
+		events[i].Timestamp = timestamps[events[i].BlockHash]
+		if transaction, ok := details[receiptKey{events[i].BlockHash, events[i].TxHash}]; ok {
+			events[i].Transaction = &transaction
+		}
+	}
+
+	return nil
+}
+
+// fetch requests the missing blocks and receipts in batches and removes the
+// ones it found from blocks and receipts.
+func (e *enricher) fetch(ctx context.Context, client *rpc.Client, blocks map[common.Hash]bool, receipts map[receiptKey]bool,
+	timestamps map[common.Hash]uint64, details map[receiptKey]Transaction) error {
+	var (
+		batch          []rpc.BatchElem
+		blockResults   = make(map[common.Hash]**rpcBlock)
+		receiptResults = make(map[receiptKey]**rpcReceipt)
+	)
+	for hash := range blocks {
+		block := new(*rpcBlock)
+		blockResults[hash] = block
+		batch = append(batch, rpc.BatchElem{Method: "eth_getBlockByHash", Args: []interface{}{hash, false}, Result: block})
+	}
+	for key := range receipts {
+		receipt := new(*rpcReceipt)
+		receiptResults[key] = receipt
+		batch = append(batch, rpc.BatchElem{Method: "eth_getTransactionReceipt", Args: []interface{}{key.tx}, Result: receipt})
+	}
+
+	// A failed element or batch leaves its results nil, so they are tried
+	// again on the next attempt.
+	var err error
+	for start := 0; start < len(batch); start += maxBatchSize {
+		end := start + maxBatchSize
+		if end > len(batch) {
+			end = len(batch)
+		}
+
+		if batchErr := client.BatchCallContext(ctx, batch[start:end]); batchErr != nil {
+			err = fmt.Errorf("failed to fetch blocks and receipts: %v", batchErr)
+			continue
+		}
+		for _, elem := range batch[start:end] {
+			if elem.Error != nil {
+				err = fmt.Errorf("failed to call %s: %v", elem.Method, elem.Error)
+			}
+		}
+	}
+
+	for hash, block := range blockResults {
+		if *block == nil {
+			continue
+		}
+		timestamps[hash] = uint64((*block).Timestamp)
+		e.timestamps.Add(hash, timestamps[hash])
+		delete(blocks, hash)
+	}
+
+	for key, receipt := range receiptResults {
+		if *receipt == nil {
+			continue
+		}
+
+		transaction := Transaction{From: (*receipt).From, GasUsed: uint64((*receipt).GasUsed)}
+		if (*receipt).EffectiveGasPrice != nil {
+			transaction.EffectiveGasPrice = (*receipt).EffectiveGasPrice.ToInt().String()
+		}
+		details[key] = transaction
+		e.receipts.Add(key, transaction)
+		delete(receipts, key)
+	}
+
+	return err
+}
@@ -0,0 +1,281 @@
+package listener
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"erc-721-checks/internal/checks"
+	"erc-721-checks/internal/metrics"
+	"erc-721-checks/internal/models"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	TransferEvent         = "Transfer"
+	ApprovalEvent         = "Approval"
+	ApprovalForAllEvent   = "ApprovalForAll"
+	RoleGrantedEvent      = "RoleGranted"
+	RoleRevokedEvent      = "RoleRevoked"
+	RoleAdminChangedEvent = "RoleAdminChanged"
+	ReorgEvent            = "Reorg"
+)
+
+// Event is the uniform envelope every decoded contract log is turned into.
+// Contract is the zero address for Reorg events, which apply to every watched
+// contract. ID is the id the event is stored under and increases as events are
+// recorded. Reorg events are not stored and have none.
+type Event struct {
+	ID          int64          `json:"id,omitempty"`
+	Contract    common.Address `json:"contract"`
+	Label       string         `json:"label,omitempty"`
+	Name        string         `json:"name"`
+	TxHash      common.Hash    `json:"txHash"`
+	LogIndex    uint           `json:"logIndex"`
+	BlockNumber uint64         `json:"blockNumber"`
+	BlockHash   common.Hash    `json:"blockHash"`
+	// Timestamp is the block time in unix seconds. Neither it nor Transaction
+	// is set on Reorg events, or when the provider did not return them.
+	Timestamp   uint64       `json:"timestamp,omitempty"`
+	Transaction *Transaction `json:"transaction,omitempty"`
+	Data        interface{}  `json:"data"`
+	// Replay and ReplayID are set on stored events that are sent again.
+	Replay   bool   `json:"replay,omitempty"`
+	ReplayID string `json:"replayId,omitempty"`
+}
+
+// Key identifies the event across redeliveries. Replays get keys of their
+// own, so each replay is delivered once more.
+func (e Event) Key() string {
+	key := fmt.Sprintf("%s:%d", e.TxHash.Hex(), e.LogIndex)
+	if e.Name == ReorgEvent {
+		key = fmt.Sprintf("reorg:%s", e.BlockHash.Hex())
+	}
+
+	if e.Replay {
+		return fmt.Sprintf("replay:%s:%s", e.ReplayID, key)
+	}
+	return key
+}
+
+// TransferData.Kind tells mints (from the zero address) and burns (to the
+// zero address) apart from regular transfers.
+type TransferData struct {
+	From    common.Address `json:"from"`
+	To      common.Address `json:"to"`
+	TokenID string         `json:"tokenId"`
+	Kind    string         `json:"kind"`
+}
+
+type ApprovalData struct {
+	Owner    common.Address `json:"owner"`
+	Approved common.Address `json:"approved"`
+	TokenID  string         `json:"tokenId"`
+}
+
+type ApprovalForAllData struct {
+	Owner    common.Address `json:"owner"`
+	Operator common.Address `json:"operator"`
+	Approved bool           `json:"approved"`
+}
+
+// RoleData is shared by RoleGranted and RoleRevoked.
+type RoleData struct {
+	Role    common.Hash    `json:"role"`
+	Account common.Address `json:"account"`
+	Sender  common.Address `json:"sender"`
+}
+
+type RoleAdminChangedData struct {
+	Role              common.Hash `json:"role"`
+	PreviousAdminRole common.Hash `json:"previousAdminRole"`
+	NewAdminRole      common.Hash `json:"newAdminRole"`
+}
+
+type eventHandler struct {
+	name      string
+	signature string
+	decode    func(instance *checks.Checks, vLog types.Log) (interface{}, error)
+}
+
+var eventHandlers = newEventHandlers([]eventHandler{
+	{name: TransferEvent, signature: "Transfer(address,address,uint256)", decode: decodeTransfer},
+	{name: ApprovalEvent, signature: "Approval(address,address,uint256)", decode: decodeApproval},
+	{name: ApprovalForAllEvent, signature: "ApprovalForAll(address,address,bool)", decode: decodeApprovalForAll},
+	{name: RoleGrantedEvent, signature: "RoleGranted(bytes32,address,address)", decode: decodeRoleGranted},
+	{name: RoleRevokedEvent, signature: "RoleRevoked(bytes32,address,address)", decode: decodeRoleRevoked},
+	{name: RoleAdminChangedEvent, signature: "RoleAdminChanged(bytes32,bytes32,bytes32)", decode: decodeRoleAdminChanged},
+})
+
+func newEventHandlers(handlers []eventHandler) map[common.Hash]eventHandler {
+	byTopic := make(map[common.Hash]eventHandler, len(handlers))
+	for _, handler := range handlers {
+		byTopic[crypto.Keccak256Hash([]byte(handler.signature))] = handler
+	}
+	return byTopic
+}
+
+// eventTopics builds the log filter topics matching every handled event.
+func eventTopics() [][]common.Hash {
+	events := make([]common.Hash, 0, len(eventHandlers))
+	for topic := range eventHandlers {
+		events = append(events, topic)
+	}
+	return [][]common.Hash{events}
+}
+
+func decodeTransfer(instance *checks.Checks, vLog types.Log) (interface{}, error) {
+	event, err := instance.ParseTransfer(vLog)
+	if err != nil {
+		return nil, err
+	}
+	return TransferData{From: event.From, To: event.To, TokenID: event.TokenId.String(), Kind: transferKind(event.From, event.To)}, nil
+}
+
+func decodeApproval(instance *checks.Checks, vLog types.Log) (interface{}, error) {
+	event, err := instance.ParseApproval(vLog)
+	if err != nil {
+		return nil, err
+	}
+	return ApprovalData{Owner: event.Owner, Approved: event.Approved, TokenID: event.TokenId.String()}, nil
+}
+
+func decodeApprovalForAll(instance *checks.Checks, vLog types.Log) (interface{}, error) {
+	event, err := instance.ParseApprovalForAll(vLog)
+	if err != nil {
+		return nil, err
+	}
+	return ApprovalForAllData{Owner: event.Owner, Operator: event.Operator, Approved: event.Approved}, nil
+}
+
+func decodeRoleGranted(instance *checks.Checks, vLog types.Log) (interface{}, error) {
+	event, err := instance.ParseRoleGranted(vLog)
+	if err != nil {
+		return nil, err
+	}
+	return RoleData{Role: event.Role, Account: event.Account, Sender: event.Sender}, nil
+}
+
+func decodeRoleRevoked(instance *checks.Checks, vLog types.Log) (interface{}, error) {
+	event, err := instance.ParseRoleRevoked(vLog)
+	if err != nil {
+		return nil, err
+	}
+	return RoleData{Role: event.Role, Account: event.Account, Sender: event.Sender}, nil
+}
+
+func decodeRoleAdminChanged(instance *checks.Checks, vLog types.Log) (interface{}, error) {
+	event, err := instance.ParseRoleAdminChanged(vLog)
+	if err != nil {
+		return nil, err
+	}
+	return RoleAdminChangedData{Role: event.Role, PreviousAdminRole: event.PreviousAdminRole, NewAdminRole: event.NewAdminRole}, nil
+}
+
+// decodeLog turns a raw log into an Event, or returns an error for logs of
+// unknown events or logs that do not match their event's ABI.
+func (l *Listener) decodeLog(c *watchedContract, vLog types.Log) (Event, error) {
+	if len(vLog.Topics) == 0 {
+		return Event{}, fmt.Errorf("log has no topics")
+	}
+
+	handler, ok := eventHandlers[vLog.Topics[0]]
+	if !ok {
+		return Event{}, fmt.Errorf("unknown event topic %s", vLog.Topics[0].Hex())
+	}
+
+	data, err := handler.decode(c.instance, vLog)
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to decode %s: %v", handler.name, err)
+	}
+
+	return Event{
+		Contract:    c.Address,
+		Label:       c.Label,
+		Name:        handler.name,
+		TxHash:      vLog.TxHash,
+		LogIndex:    vLog.Index,
+		BlockNumber: vLog.BlockNumber,
+		BlockHash:   vLog.BlockHash,
+		Data:        data,
+	}, nil
+}
+
+// StoredEvent turns a stored event back into an Event. Data is left as the
+// stored JSON. label restores the contract label, which is not stored.
+func StoredEvent(stored models.Event, label string) Event {
+	event := Event{
+		ID:          stored.ID,
+		Contract:    common.HexToAddress(stored.ContractAddress),
+		Label:       label,
+		Name:        stored.Name,
+		TxHash:      common.HexToHash(stored.TxHash),
+		LogIndex:    stored.LogIndex,
+		BlockNumber: stored.BlockNumber,
+		BlockHash:   common.HexToHash(stored.BlockHash),
+		Timestamp:   stored.BlockTimestamp,
+		Data:        json.RawMessage(stored.Data),
+	}
+	if stored.TxFrom != "" {
+		event.Transaction = &Transaction{
+			From:              common.HexToAddress(stored.TxFrom),
+			GasUsed:           stored.GasUsed,
+			EffectiveGasPrice: stored.EffectiveGasPrice,
+		}
+	}
+
+	return event
+}
+
+func (l *Listener) handleEvent(event Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s data: %v", event.Name, err)
+	}
+
+	stored := models.Event{
+		ContractAddress: event.Contract.Hex(),
+		Name:            event.Name,
+		TxHash:          event.TxHash.Hex(),
+		LogIndex:        event.LogIndex,
+		BlockNumber:     event.BlockNumber,
+		BlockHash:       event.BlockHash.Hex(),
+		BlockTimestamp:  event.Timestamp,
+		Data:            string(data),
+	}
+	if event.Transaction != nil {
+		stored.TxFrom = event.Transaction.From.Hex()
+		stored.GasUsed = event.Transaction.GasUsed
+		stored.EffectiveGasPrice = event.Transaction.EffectiveGasPrice
+	}
+
+	id, err := l.repositories.Events.UpsertEvent(stored)
+	if err != nil {
+		return fmt.Errorf("failed to store event: %v", err)
+	}
+	event.ID = id
+
+	switch data := event.Data.(type) {
+	case TransferData:
+		err = l.handleTransfer(event, data)
+	case RoleData:
+		err = l.handleRoleChange(event, data)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := l.emit(event); err != nil {
+		return err
+	}
+
+	contract := event.Label
+	if contract == "" {
+		contract = event.Contract.Hex()
+	}
+	metrics.EventsProcessed.WithLabelValues(contract, event.Name).Inc()
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package listener
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// TokenRange matches token IDs from Min to Max inclusive. A single token ID
+// has Min equal to Max.
+type TokenRange struct {
+	Min *big.Int
+	Max *big.Int
+}
+
+// Filter restricts the events sent to the sinks, empty fields match
+// everything. From, To and TokenIDs only restrict Transfer events. Every event
+// is still fetched, stored and indexed, so token owners, balances and minters
+// stay complete whatever the filter.
+type Filter struct {
+	Events   []string
+	From     []common.Address
+	To       []common.Address
+	TokenIDs []TokenRange
+}
+
+func (f Filter) validate() error {
+	known := make(map[string]bool, len(eventHandlers))
+	for _, handler := range eventHandlers {
+		known[handler.name] = true
+	}
+
+	for _, name := range f.Events {
+		if !known[name] {
+			return fmt.Errorf("unknown event %q", name)
+		}
+	}
+
+	for _, tokenRange := range f.TokenIDs {
+		if tokenRange.Min.Sign() < 0 || tokenRange.Min.Cmp(tokenRange.Max) > 0 {
+			return fmt.Errorf("invalid token id range %s-%s", tokenRange.Min, tokenRange.Max)
+		}
+	}
+
+	return nil
+}
+
+// Match reports whether the event passes the filter. Reorg events always do,
+// since consumers need them to undo the events they received.
+func (f Filter) Match(event Event) bool {
+	if event.Name == ReorgEvent {
+		return true
+	}
+	if len(f.Events) > 0 && !contains(f.Events, event.Name) {
+		return false
+	}
+
+	transfer, ok := event.Data.(TransferData)
+	if !ok {
+		return true
+	}
+
+	if len(f.From) > 0 && !contains(f.From, transfer.From) {
+		return false
+	}
+	if len(f.To) > 0 && !contains(f.To, transfer.To) {
+		return false
+	}
+
+	if len(f.TokenIDs) == 0 {
+		return true
+	}
+
+	tokenID, ok := new(big.Int).SetString(transfer.TokenID, 10)
+	if !ok {
+		return false
+	}
+	for _, tokenRange := range f.TokenIDs {
+		if tokenID.Cmp(tokenRange.Min) >= 0 && tokenID.Cmp(tokenRange.Max) <= 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains[T comparable](values []T, value T) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"erc-721-checks/internal/metrics"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const finalityCheckInterval = 15 * time.Second
+
+// finalizedBlock returns the highest block whose transfers can be confirmed,
+// and false when the chain is not deep enough yet.
+func (l *Listener) finalizedBlock(ctx context.Context) (uint64, bool, error) {
+	if l.config.UseFinalizedTag {
+		header, err := l.client.HeaderByNumber(ctx, big.NewInt(int64(rpc.FinalizedBlockNumber)))
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to retrieve finalized block: %v", err)
+		}
+		return header.Number.Uint64(), true, nil
+	}
+
+	head, err := l.client.BlockNumber(ctx)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to retrieve head block number: %v", err)
+	}
+
+	if head < l.config.Confirmations {
+		return 0, false, nil
+	}
+
+	return head - l.config.Confirmations, true, nil
+}
+
+func (l *Listener) confirmTransfers(ctx context.Context) error {
+	blockNumber, ok, err := l.finalizedBlock(ctx)
+	if err != nil || !ok {
+		return err
+	}
+
+	confirmed, err := l.repositories.Transfers.ConfirmTransfers(blockNumber)
+	if err != nil {
+		return err
+	}
+
+	if confirmed > 0 {
+		fmt.Printf("Confirmed %d transfers up to block %d\n\n", confirmed, blockNumber)
+	}
+
+	return nil
+}
+
+// updateHeadLag compares the chain head with the last processed block. While
+// live, blocks up to the head seen on the previous check count as processed:
+// quiet blocks never move the checkpoint, and any logs they had were given a
+// whole check interval to arrive.
+func (l *Listener) updateHeadLag(ctx context.Context) error {
+	head, err := l.client.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve head block number: %v", err)
+	}
+
+	var processed uint64
+	if l.nextBlock > 0 {
+		processed = l.nextBlock - 1
+	}
+	if l.seenHead > processed {
+		processed = l.seenHead
+	}
+	l.seenHead = head
+	l.processed.Store(processed)
+
+	var lag uint64
+	if head > processed {
+		lag = head - processed
+	}
+	metrics.HeadLag.Set(float64(lag))
+
+	return nil
+}
@@ -0,0 +1,431 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"erc-721-checks/internal/checks"
+	"erc-721-checks/internal/contract"
+	"erc-721-checks/internal/database"
+	"erc-721-checks/internal/ipfs"
+	"erc-721-checks/internal/metrics"
+	"erc-721-checks/internal/models"
+	"erc-721-checks/internal/utils"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	defaultChunkSize  = 2000
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 2 * time.Minute
+)
+
+// Contract is a deployment the listener follows. Label is only used to tell
+// contracts apart in the emitted events.
+type Contract struct {
+	Address common.Address
+	Label   string
+	// StartBlock is used when the contract has no checkpoint yet. When nil its
+	// deployment block is looked up on chain.
+	StartBlock *uint64
+}
+
+type Config struct {
+	ChunkSize uint64
+	// Confirmations is how many blocks deep a transfer has to be before it is
+	// promoted from pending to confirmed. Ignored when UseFinalizedTag is set,
+	// in which case the provider's "finalized" block is used instead.
+	Confirmations   uint64
+	UseFinalizedTag bool
+	// Polling replaces the websocket subscription with eth_getLogs calls every
+	// PollInterval, for providers that only expose HTTP.
+	Polling      bool
+	PollInterval time.Duration
+	// IPFSGatewayURL is where minted token metadata is fetched from. Metadata
+	// stays queued until it is set.
+	IPFSGatewayURL string
+	Filter         Filter
+}
+
+type Repositories struct {
+	Events      *models.EventRepository
+	Transfers   *models.TransferRepository
+	Minters     *models.MinterRepository
+	Tokens      *models.TokenRepository
+	Metadata    *models.TokenMetadataRepository
+	Checkpoints *models.CheckpointRepository
+}
+
+// watchedContract tracks the progress of a single contract. Contracts resume
+// from their own checkpoints, so nextBlock only differs between them until
+// the first backfill caught up.
+type watchedContract struct {
+	Contract
+	instance  *checks.Checks
+	nextBlock uint64
+}
+
+// Listener follows every configured contract over a single client connection
+// and processes their logs in chain order. MINTER_ROLE changes are only
+// mirrored into the minters table for the first contract, the one managed by
+// the admin tool.
+type Listener struct {
+	client       *ethclient.Client
+	rpcClient    *rpc.Client
+	contracts    []*watchedContract
+	byAddress    map[common.Address]*watchedContract
+	repositories Repositories
+	sinks        []Sink
+	config       Config
+	nextBlock    uint64
+	seenHead     uint64
+	started      bool
+	blocks       *blockTracker
+	ipfs         *ipfs.Client
+	topics       [][]common.Hash
+	enricher     *enricher
+
+	// Progress is read by health checks from other goroutines.
+	live       atomic.Bool
+	processed  atomic.Uint64
+	lastActive atomic.Int64
+}
+
+func NewListener(client *rpc.Client, contracts []Contract, repositories Repositories, sinks []Sink, config Config) (*Listener, error) {
+	if len(contracts) == 0 {
+		return nil, fmt.Errorf("no contracts to listen to")
+	}
+
+	if config.ChunkSize == 0 {
+		config.ChunkSize = defaultChunkSize
+	}
+
+	if err := config.Filter.validate(); err != nil {
+		return nil, err
+	}
+
+	l := &Listener{
+		byAddress:    make(map[common.Address]*watchedContract, len(contracts)),
+		repositories: repositories,
+		sinks:        sinks,
+		config:       config,
+		blocks:       newBlockTracker(),
+		topics:       eventTopics(),
+		enricher:     newEnricher(),
+	}
+	for _, c := range contracts {
+		if _, ok := l.byAddress[c.Address]; ok {
+			return nil, fmt.Errorf("contract %s is listed twice", c.Address.Hex())
+		}
+
+		watched := &watchedContract{Contract: c}
+		l.contracts = append(l.contracts, watched)
+		l.byAddress[c.Address] = watched
+	}
+
+	if err := l.bind(client); err != nil {
+		return nil, err
+	}
+
+	if config.IPFSGatewayURL != "" {
+		l.ipfs = ipfs.NewClient(config.IPFSGatewayURL)
+	}
+	l.touch()
+
+	return l, nil
+}
+
+// bind switches every contract over to the given client.
+func (l *Listener) bind(rpcClient *rpc.Client) error {
+	client := ethclient.NewClient(rpcClient)
+	for _, c := range l.contracts {
+		instance, err := checks.NewChecks(c.Address, client)
+		if err != nil {
+			return fmt.Errorf("failed to instantiate contract %s: %v", c.Address.Hex(), err)
+		}
+		c.instance = instance
+	}
+
+	if l.client != nil {
+		l.client.Close()
+	}
+	l.client = client
+	l.rpcClient = rpcClient
+	return nil
+}
+
+func (l *Listener) reconnect(ctx context.Context) error {
+	client, err := contract.DialRPC(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := l.bind(client); err != nil {
+		client.Close()
+		return err
+	}
+
+	return nil
+}
+
+// primary is the contract whose minters are tracked.
+func (l *Listener) primary() *watchedContract {
+	return l.contracts[0]
+}
+
+func (l *Listener) addresses() []common.Address {
+	addresses := make([]common.Address, 0, len(l.contracts))
+	for _, c := range l.contracts {
+		addresses = append(addresses, c.Address)
+	}
+	return addresses
+}
+
+// Run keeps the listener alive until ctx is cancelled: whenever a session
+// fails, e.g. because the websocket dropped, the client is redialed with
+// exponential backoff and the next session resumes from the last processed
+// block. On cancellation the log in progress is finished, the checkpoint is
+// flushed and the client closed before Run returns. The flush is skipped when
+// ctx was cancelled because leadership was lost, as another instance may be
+// processing the same blocks by then.
+func (l *Listener) Run(ctx context.Context) error {
+	defer l.client.Close()
+
+	for attempt := 0; ; attempt++ {
+		err := l.listen(ctx)
+		if ctx.Err() != nil {
+			return l.stop(ctx)
+		}
+
+		if l.live.Swap(false) {
+			attempt = 0
+		}
+
+		delay := utils.Backoff(attempt, minReconnectDelay, maxReconnectDelay)
+		fmt.Printf("Listener stopped: %v\nReconnecting in %s...\n\n", err, delay.Round(time.Millisecond))
+
+		select {
+		case <-ctx.Done():
+			return l.stop(ctx)
+		case <-time.After(delay):
+		}
+
+		l.touch()
+		metrics.Reconnects.Inc()
+		if err := l.reconnect(ctx); err != nil {
+			fmt.Printf("failed to reconnect: %v\n", err)
+		}
+	}
+}
+
+func (l *Listener) stop(ctx context.Context) error {
+	if errors.Is(context.Cause(ctx), database.ErrLeadershipLost) {
+		fmt.Printf("Listener stopped after losing leadership at block %d\n\n", l.nextBlock)
+		return nil
+	}
+	return l.flush()
+}
+
+// flush stores the position the next run resumes from. Every block before
+// nextBlock is complete, later ones may have been handled only partly and are
+// processed again.
+func (l *Listener) flush() error {
+	if !l.started || l.nextBlock == 0 {
+		return nil
+	}
+
+	if err := l.saveCheckpoint(l.nextBlock - 1); err != nil {
+		return fmt.Errorf("failed to flush checkpoint: %v", err)
+	}
+
+	fmt.Printf("Listener stopped after block %d\n\n", l.nextBlock-1)
+	return nil
+}
+
+// listen subscribes to new logs first and only then backfills history up to
+// the current head, so nothing emitted in between is missed. Live logs already
+// covered by the backfill are skipped.
+func (l *Listener) listen(ctx context.Context) error {
+	l.seenHead = 0
+
+	logs := make(chan types.Log)
+	sub, err := l.subscribe(ctx, logs)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to contract logs: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	if err := l.backfill(ctx); err != nil {
+		return err
+	}
+
+	if err := l.confirmTransfers(ctx); err != nil {
+		return err
+	}
+
+	finalityTicker := time.NewTicker(finalityCheckInterval)
+	defer finalityTicker.Stop()
+
+	metadataTicker := time.NewTicker(metadataCheckInterval)
+	defer metadataTicker.Stop()
+
+	l.live.Store(true)
+	fmt.Printf("Listening to the events of %d contracts. Waiting for new events...\n\n", len(l.contracts))
+	for {
+		l.touch()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-sub.Err():
+			return fmt.Errorf("subscription failed: %v", err)
+		case vLog := <-logs:
+			if err := l.handleLiveLog(ctx, vLog); err != nil {
+				return err
+			}
+		case <-finalityTicker.C:
+			if err := l.confirmTransfers(ctx); err != nil {
+				return err
+			}
+			if err := l.updateHeadLag(ctx); err != nil {
+				return err
+			}
+		case <-metadataTicker.C:
+			if err := l.resolveMetadata(ctx); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// filterQuery requests every handled event of the contracts. Filter is not
+// turned into topics, since storage and the indexes need every log and the
+// sinks are never the only consumer.
+func (l *Listener) filterQuery(fromBlock, toBlock *big.Int, addresses []common.Address) ethereum.FilterQuery {
+	return ethereum.FilterQuery{
+		FromBlock: fromBlock,
+		ToBlock:   toBlock,
+		Addresses: addresses,
+		Topics:    l.topics,
+	}
+}
+
+func (l *Listener) handleLiveLog(ctx context.Context, vLog types.Log) error {
+	if blockNumber, orphanedHash, reorged := l.detectReorg(vLog); reorged {
+		return l.handleReorg(ctx, blockNumber, orphanedHash)
+	}
+
+	if vLog.Removed {
+		return nil
+	}
+
+	// Skip logs already covered by the backfill. A log from an earlier block we
+	// have no hash for can only come from a reorg that added events, so it is
+	// applied normally.
+	if knownHash, ok := l.blocks.hash(vLog.BlockNumber); ok && knownHash == vLog.BlockHash && vLog.BlockNumber < l.nextBlock {
+		return nil
+	}
+
+	// Logs arrive in block order, so every block before this one is complete.
+	if vLog.BlockNumber > l.nextBlock {
+		if err := l.saveCheckpoint(vLog.BlockNumber - 1); err != nil {
+			return err
+		}
+	}
+
+	return l.handleLog(ctx, vLog)
+}
+
+// handleLog decodes and records a single log. Logs that cannot be decoded are
+// reported and skipped rather than stopping the listener.
+func (l *Listener) handleLog(ctx context.Context, vLog types.Log) error {
+	event, ok := l.prepareLog(vLog)
+	if !ok {
+		return nil
+	}
+
+	events := []Event{event}
+	if err := l.enricher.enrich(ctx, l.rpcClient, events); err != nil {
+		return err
+	}
+
+	return l.handleEvent(events[0])
+}
+
+// prepareLog decodes a log into an event. Logs from unknown contracts and
+// malformed logs are skipped.
+func (l *Listener) prepareLog(vLog types.Log) (Event, bool) {
+	l.blocks.add(vLog.BlockNumber, vLog.BlockHash)
+
+	c, ok := l.byAddress[vLog.Address]
+	if !ok {
+		fmt.Printf("Skipping log %d in transaction %s from unknown contract %s\n\n", vLog.Index, vLog.TxHash.Hex(), vLog.Address.Hex())
+		return Event{}, false
+	}
+
+	event, err := l.decodeLog(c, vLog)
+	if err != nil {
+		metrics.DecodeErrors.Inc()
+		fmt.Printf("Skipping malformed log %d in transaction %s: %v\n\n", vLog.Index, vLog.TxHash.Hex(), err)
+		return Event{}, false
+	}
+
+	return event, true
+}
+
+// saveCheckpoint marks every block up to blockNumber as processed. Contracts
+// whose own checkpoint is already further ahead are left untouched.
+func (l *Listener) saveCheckpoint(blockNumber uint64) error {
+	for _, c := range l.contracts {
+		if c.nextBlock > blockNumber+1 {
+			continue
+		}
+
+		if err := l.repositories.Checkpoints.SaveCheckpoint(models.Checkpoint{
+			ContractAddress: c.Address.Hex(),
+			BlockNumber:     blockNumber,
+		}); err != nil {
+			return err
+		}
+		c.nextBlock = blockNumber + 1
+	}
+
+	l.nextBlock = l.lowestNextBlock()
+	l.processed.Store(l.nextBlock - 1)
+	return nil
+}
+
+// Progress returns the last block the listener processed and whether it is
+// following the chain live rather than backfilling or reconnecting.
+func (l *Listener) Progress() (processedBlock uint64, live bool) {
+	return l.processed.Load(), l.live.Load()
+}
+
+// LastActive returns when the listener loop last made progress.
+func (l *Listener) LastActive() time.Time {
+	return time.Unix(0, l.lastActive.Load())
+}
+
+func (l *Listener) touch() {
+	l.lastActive.Store(time.Now().UnixNano())
+}
+
+// lowestNextBlock is the first block not processed for every contract yet.
+func (l *Listener) lowestNextBlock() uint64 {
+	lowest := l.contracts[0].nextBlock
+	for _, c := range l.contracts[1:] {
+		if c.nextBlock < lowest {
+			lowest = c.nextBlock
+		}
+	}
+	return lowest
+}
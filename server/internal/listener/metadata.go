@@ -0,0 +1,147 @@
+package listener
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"erc-721-checks/internal/ipfs"
+	"erc-721-checks/internal/models"
+	"erc-721-checks/internal/utils"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	metadataCheckInterval = 10 * time.Second
+	// metadataTimeBudget bounds how long a single check may hold up event
+	// processing, since both run on the listener loop.
+	metadataTimeBudget    = 5 * time.Second
+	metadataBatchSize     = 20
+	maxMetadataAttempts   = 8
+	minMetadataRetryDelay = 30 * time.Second
+	maxMetadataRetryDelay = 6 * time.Hour
+)
+
+var errInvalidMetadata = errors.New("invalid token metadata")
+
+// resolveMetadata works through the metadata retry queue until it is empty or
+// the time budget is spent.
+func (l *Listener) resolveMetadata(ctx context.Context) error {
+	if l.ipfs == nil {
+		return nil
+	}
+
+	deadline := time.Now().Add(metadataTimeBudget)
+	for time.Now().Before(deadline) {
+		queue, err := l.repositories.Metadata.GetDueMetadata(metadataBatchSize)
+		if err != nil || len(queue) == 0 {
+			return err
+		}
+
+		for _, metadata := range queue {
+			if err := l.resolveTokenMetadata(ctx, metadata); err != nil {
+				return err
+			}
+			if time.Now().After(deadline) {
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
+
+func (l *Listener) resolveTokenMetadata(ctx context.Context, metadata models.TokenMetadata) error {
+	metadata.Attempts++
+
+	content, err := l.fetchMetadata(ctx, &metadata)
+	if err == nil {
+		metadata.Metadata = content
+		fmt.Printf("Metadata resolved for token %s from %s\n\n", metadata.TokenID, metadata.URI)
+		return l.repositories.Metadata.SaveMetadata(metadata)
+	}
+
+	// An interrupted fetch is not the token's fault and is not counted.
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	metadata.LastError = err.Error()
+	metadata.Status = failedMetadataStatus(err, metadata.Attempts)
+
+	fmt.Printf("Failed to resolve metadata for token %s (attempt %d): %v\n\n", metadata.TokenID, metadata.Attempts, err)
+
+	nextAttemptAt := time.Now().Add(utils.Backoff(metadata.Attempts-1, minMetadataRetryDelay, maxMetadataRetryDelay))
+	return l.repositories.Metadata.MarkAttemptFailed(metadata, nextAttemptAt)
+}
+
+// failedMetadataStatus decides whether a failed attempt is retried. Content
+// that does not match its CID or the schema is invalid whatever the gateway,
+// other errors such as an unreachable gateway are retried until
+// maxMetadataAttempts.
+func failedMetadataStatus(err error, attempts int) int {
+	switch {
+	case errors.Is(err, ipfs.ErrInvalidContent), errors.Is(err, ipfs.ErrUnsupported), errors.Is(err, errInvalidMetadata):
+		return models.InvalidMetadataStatus
+	case attempts >= maxMetadataAttempts:
+		return models.FailedMetadataStatus
+	default:
+		return models.PendingMetadataStatus
+	}
+}
+
+func (l *Listener) fetchMetadata(ctx context.Context, metadata *models.TokenMetadata) (string, error) {
+	if metadata.URI == "" {
+		c, ok := l.byAddress[common.HexToAddress(metadata.ContractAddress)]
+		if !ok {
+			return "", fmt.Errorf("contract %s is not watched", metadata.ContractAddress)
+		}
+
+		tokenID, ok := new(big.Int).SetString(metadata.TokenID, 10)
+		if !ok {
+			return "", fmt.Errorf("%w: token id %q", errInvalidMetadata, metadata.TokenID)
+		}
+
+		uri, err := c.instance.TokenURI(&bind.CallOpts{Context: ctx}, tokenID)
+		if err != nil {
+			return "", fmt.Errorf("failed to get token uri: %v", err)
+		}
+		metadata.URI = uri
+	}
+
+	content, err := l.ipfs.Fetch(ctx, metadata.URI)
+	if err != nil {
+		return "", err
+	}
+
+	return validateMetadata(content)
+}
+
+// validateMetadata checks the ERC-721 metadata JSON schema fields that are
+// present and returns the document in compact form.
+func validateMetadata(content []byte) (string, error) {
+	var document map[string]interface{}
+	if err := json.Unmarshal(content, &document); err != nil {
+		return "", fmt.Errorf("%w: %v", errInvalidMetadata, err)
+	}
+
+	for _, field := range []string{"name", "description", "image"} {
+		if value, ok := document[field]; ok {
+			if _, isString := value.(string); !isString {
+				return "", fmt.Errorf("%w: %s must be a string", errInvalidMetadata, field)
+			}
+		}
+	}
+
+	compact, err := json.Marshal(document)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errInvalidMetadata, err)
+	}
+
+	return string(compact), nil
+}
@@ -0,0 +1,73 @@
+package listener
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"erc-721-checks/internal/ipfs"
+	"erc-721-checks/internal/models"
+)
+
+func TestValidateMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		metadata string
+		err      error
+	}{
+		{name: "full", content: `{"name": "Check", "description": "A check", "image": "ipfs://x"}`,
+			metadata: `{"description":"A check","image":"ipfs://x","name":"Check"}`},
+		{name: "extra fields", content: `{"name": "Check", "attributes": [{"value": 1}]}`,
+			metadata: `{"attributes":[{"value":1}],"name":"Check"}`},
+		{name: "no schema fields", content: `{}`, metadata: `{}`},
+		{name: "not json", content: `<html>`, err: errInvalidMetadata},
+		{name: "array", content: `[]`, err: errInvalidMetadata},
+		{name: "name not a string", content: `{"name": 1}`, err: errInvalidMetadata},
+		{name: "image not a string", content: `{"image": null}`, err: errInvalidMetadata},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metadata, err := validateMetadata([]byte(test.content))
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("validateMetadata(%s) error = %v, want %v", test.content, err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validateMetadata(%s) error = %v", test.content, err)
+			}
+			if metadata != test.metadata {
+				t.Errorf("validateMetadata(%s) = %s, want %s", test.content, metadata, test.metadata)
+			}
+		})
+	}
+}
+
+func TestFailedMetadataStatus(t *testing.T) {
+	unreachable := errors.New("failed to fetch block: connection refused")
+
+	tests := []struct {
+		name     string
+		err      error
+		attempts int
+		status   int
+	}{
+		{name: "unreachable gateway", err: unreachable, attempts: 1, status: models.PendingMetadataStatus},
+		{name: "unreachable gateway before the last attempt", err: unreachable, attempts: maxMetadataAttempts - 1, status: models.PendingMetadataStatus},
+		{name: "unreachable gateway on the last attempt", err: unreachable, attempts: maxMetadataAttempts, status: models.FailedMetadataStatus},
+		{name: "content not matching its CID", err: fmt.Errorf("%w: block", ipfs.ErrInvalidContent), attempts: 1, status: models.InvalidMetadataStatus},
+		{name: "unsupported uri", err: fmt.Errorf("%w: uri", ipfs.ErrUnsupported), attempts: 1, status: models.InvalidMetadataStatus},
+		{name: "invalid metadata", err: fmt.Errorf("%w: name must be a string", errInvalidMetadata), attempts: 1, status: models.InvalidMetadataStatus},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if status := failedMetadataStatus(test.err, test.attempts); status != test.status {
+				t.Errorf("failedMetadataStatus(%v, %d) = %d, want %d", test.err, test.attempts, status, test.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+
+	"erc-721-checks/internal/contract"
+	"erc-721-checks/internal/models"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// handleRoleChange mirrors MINTER_ROLE grants and revocations of the primary
+// contract into the minters table, whoever sent the transaction.
+func (l *Listener) handleRoleChange(event Event, role RoleData) error {
+	if event.Contract != l.primary().Address || role.Role != contract.MinterRoleHash {
+		return nil
+	}
+
+	status := models.ActiveMinterStatus
+	if event.Name == RoleRevokedEvent {
+		status = models.ArchivedMinterStatus
+	}
+
+	updated, err := l.repositories.Minters.ApplyRoleChange(models.Minter{
+		Address:     role.Account.Hex(),
+		Status:      status,
+		BlockNumber: event.BlockNumber,
+		TxHash:      event.TxHash.Hex(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update minter %s: %v", role.Account.Hex(), err)
+	}
+
+	if updated {
+		fmt.Printf("Minter %s status set to %d by transaction %s\n\n", role.Account.Hex(), status, event.TxHash.Hex())
+	}
+
+	return nil
+}
+
+// resyncMinters restores the on-chain status of minters whose last recorded
+// change came from a block that was orphaned by a reorg. The change is dated
+// just before the reorg so that re-applied canonical events take precedence.
+func (l *Listener) resyncMinters(ctx context.Context, blockNumber uint64) error {
+	minters, err := l.repositories.Minters.GetMintersChangedFromBlock(blockNumber)
+	if err != nil {
+		return err
+	}
+
+	for _, minter := range minters {
+		hasRole, err := l.primary().instance.HasRole(&bind.CallOpts{Context: ctx}, contract.MinterRoleHash, common.HexToAddress(minter.Address))
+		if err != nil {
+			return fmt.Errorf("failed to check if minter has role: %v", err)
+		}
+
+		minter.Status = models.ArchivedMinterStatus
+		if hasRole {
+			minter.Status = models.ActiveMinterStatus
+		}
+		if blockNumber > 0 {
+			minter.BlockNumber = blockNumber - 1
+		}
+
+		if err := l.repositories.Minters.ResetRoleChange(minter); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
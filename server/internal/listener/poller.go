@@ -0,0 +1,167 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+const (
+	defaultPollInterval = 15 * time.Second
+	// pollOverlapBlocks is how many already polled blocks are fetched again on
+	// every poll so that reorgs can be noticed without a subscription.
+	pollOverlapBlocks = 16
+)
+
+// poller emulates SubscribeFilterLogs over plain eth_getLogs calls. Logs from
+// blocks that were replaced by a reorg are redelivered with Removed set, the
+// same way a websocket subscription reports them.
+type poller struct {
+	ctx       context.Context
+	l         *Listener
+	logs      chan<- types.Log
+	nextBlock uint64
+	delivered map[uint64][]types.Log
+}
+
+func (l *Listener) subscribe(ctx context.Context, logs chan<- types.Log) (ethereum.Subscription, error) {
+	if !l.config.Polling {
+		return l.client.SubscribeFilterLogs(ctx, l.filterQuery(nil, nil, l.addresses()), logs)
+	}
+
+	head, err := l.client.BlockNumber(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve head block number: %v", err)
+	}
+
+	p := &poller{
+		ctx:       ctx,
+		l:         l,
+		logs:      logs,
+		nextBlock: head + 1,
+		delivered: make(map[uint64][]types.Log),
+	}
+
+	return event.NewSubscription(p.run), nil
+}
+
+func (p *poller) run(quit <-chan struct{}) error {
+	interval := p.l.config.PollInterval
+	if interval == 0 {
+		interval = defaultPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-quit:
+			return nil
+		case <-ticker.C:
+			if err := p.poll(quit); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (p *poller) poll(quit <-chan struct{}) error {
+	head, err := p.l.client.BlockNumber(p.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve head block number: %v", err)
+	}
+
+	start := p.nextBlock
+	if start > pollOverlapBlocks {
+		start -= pollOverlapBlocks
+	} else {
+		start = 0
+	}
+
+	for start <= head {
+		end := start + p.l.config.ChunkSize - 1
+		if end > head {
+			end = head
+		}
+
+		logs, err := p.l.client.FilterLogs(p.ctx,
+			p.l.filterQuery(new(big.Int).SetUint64(start), new(big.Int).SetUint64(end), p.l.addresses()))
+		if err != nil {
+			return fmt.Errorf("failed to poll logs in blocks %d-%d: %v", start, end, err)
+		}
+
+		if !p.deliver(start, end, logs, quit) {
+			return nil
+		}
+		start = end + 1
+	}
+
+	if head+1 > p.nextBlock {
+		p.nextBlock = head + 1
+	}
+
+	for blockNumber := range p.delivered {
+		if blockNumber+pollOverlapBlocks < p.nextBlock {
+			delete(p.delivered, blockNumber)
+		}
+	}
+
+	return nil
+}
+
+// deliver sends the logs of every block in the range that is new or whose
+// hash changed since the previous poll. It returns false when the
+// subscription was closed in the meantime.
+func (p *poller) deliver(start, end uint64, logs []types.Log, quit <-chan struct{}) bool {
+	byBlock := make(map[uint64][]types.Log)
+	for _, vLog := range logs {
+		byBlock[vLog.BlockNumber] = append(byBlock[vLog.BlockNumber], vLog)
+	}
+
+	for blockNumber := start; blockNumber <= end; blockNumber++ {
+		fresh := byBlock[blockNumber]
+		previous, seen := p.delivered[blockNumber]
+		if seen && len(fresh) > 0 && fresh[0].BlockHash == previous[0].BlockHash {
+			continue
+		}
+
+		if seen {
+			for i := len(previous) - 1; i >= 0; i-- {
+				removed := previous[i]
+				removed.Removed = true
+				if !p.send(removed, quit) {
+					return false
+				}
+			}
+			delete(p.delivered, blockNumber)
+		}
+
+		if len(fresh) == 0 {
+			continue
+		}
+
+		for _, vLog := range fresh {
+			if !p.send(vLog, quit) {
+				return false
+			}
+		}
+		p.delivered[blockNumber] = fresh
+	}
+
+	return true
+}
+
+func (p *poller) send(vLog types.Log, quit <-chan struct{}) bool {
+	select {
+	case p.logs <- vLog:
+		return true
+	case <-quit:
+		return false
+	}
+}
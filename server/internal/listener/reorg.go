@@ -0,0 +1,138 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const blockHistorySize = 128
+
+// ReorgData is emitted as a Reorg event whose block number and hash are those
+// of the first orphaned block.
+type ReorgData struct {
+	RemovedEvents int64 `json:"removedEvents"`
+}
+
+// blockTracker remembers the hash of every recent block we recorded logs from.
+type blockTracker struct {
+	hashes  map[uint64]common.Hash
+	highest uint64
+}
+
+func newBlockTracker() *blockTracker {
+	return &blockTracker{hashes: make(map[uint64]common.Hash)}
+}
+
+func (bt *blockTracker) add(blockNumber uint64, hash common.Hash) {
+	bt.hashes[blockNumber] = hash
+	if blockNumber <= bt.highest {
+		return
+	}
+
+	bt.highest = blockNumber
+	for number := range bt.hashes {
+		if number+blockHistorySize < bt.highest {
+			delete(bt.hashes, number)
+		}
+	}
+}
+
+func (bt *blockTracker) hash(blockNumber uint64) (common.Hash, bool) {
+	hash, ok := bt.hashes[blockNumber]
+	return hash, ok
+}
+
+func (bt *blockTracker) rewind(blockNumber uint64) {
+	for number := range bt.hashes {
+		if number >= blockNumber {
+			delete(bt.hashes, number)
+		}
+	}
+	if bt.highest >= blockNumber && blockNumber > 0 {
+		bt.highest = blockNumber - 1
+	}
+}
+
+// detectReorg reports whether the log proves that a block we recorded has been
+// orphaned, returning the first orphaned block number and its hash.
+func (l *Listener) detectReorg(vLog types.Log) (uint64, common.Hash, bool) {
+	known, ok := l.blocks.hash(vLog.BlockNumber)
+	if !ok {
+		return 0, common.Hash{}, false
+	}
+
+	if vLog.Removed {
+		// Removed logs for blocks that were already rolled back are ignored.
+		return vLog.BlockNumber, known, known == vLog.BlockHash
+	}
+
+	return vLog.BlockNumber, known, known != vLog.BlockHash
+}
+
+// handleReorg rolls back everything recorded from the orphaned block onwards
+// and re-applies the canonical logs up to the current head. Every watched
+// contract is rolled back, since they share the same chain.
+func (l *Listener) handleReorg(ctx context.Context, blockNumber uint64, orphanedHash common.Hash) error {
+	var removed int64
+	for _, c := range l.contracts {
+		address := c.Address.Hex()
+
+		removedEvents, err := l.repositories.Events.DeleteEventsFromBlock(address, blockNumber)
+		if err != nil {
+			return err
+		}
+		removed += removedEvents
+
+		if _, err := l.repositories.Transfers.DeleteTransfersFromBlock(address, blockNumber); err != nil {
+			return err
+		}
+
+		if err := l.repositories.Tokens.RollbackFromBlock(address, blockNumber); err != nil {
+			return err
+		}
+
+		if c.nextBlock > blockNumber {
+			c.nextBlock = blockNumber
+		}
+	}
+
+	if err := l.resyncMinters(ctx, blockNumber); err != nil {
+		return err
+	}
+
+	l.blocks.rewind(blockNumber)
+	if blockNumber > 0 {
+		if err := l.saveCheckpoint(blockNumber - 1); err != nil {
+			return err
+		}
+	} else {
+		l.nextBlock = 0
+	}
+
+	if err := l.emit(Event{
+		Name:        ReorgEvent,
+		BlockNumber: blockNumber,
+		BlockHash:   orphanedHash,
+		Data:        ReorgData{RemovedEvents: removed},
+	}); err != nil {
+		return err
+	}
+
+	head, err := l.client.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve head block number: %v", err)
+	}
+
+	if blockNumber > head {
+		return nil
+	}
+
+	if err := l.backfillRange(ctx, blockNumber, head); err != nil {
+		return err
+	}
+
+	return l.saveCheckpoint(head)
+}
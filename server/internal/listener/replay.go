@@ -0,0 +1,68 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+
+	"erc-721-checks/internal/models"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// replayChunkSize is how many blocks of stored events are loaded at once.
+const replayChunkSize = 1000
+
+// ReplayQuery selects stored events by block range, inclusive. An empty
+// Contract or Event matches every contract or event. Filter is applied on top,
+// as it is to live events.
+type ReplayQuery struct {
+	Contract  string
+	Event     string
+	FromBlock uint64
+	ToBlock   uint64
+	Filter    Filter
+}
+
+// Replay sends the stored events matching the query through the sinks in
+// chain order, marked as a replay with the given id. Running a replay again
+// with the same id does not queue webhook deliveries twice. labels restores
+// the contract labels, which are not stored. It returns the number of events
+// sent.
+func Replay(ctx context.Context, repository *models.EventRepository, sinks []Sink, query ReplayQuery, id string, labels map[common.Address]string) (int, error) {
+	sent := 0
+	for start := query.FromBlock; start <= query.ToBlock; start += replayChunkSize {
+		if err := ctx.Err(); err != nil {
+			return sent, err
+		}
+
+		end := start + replayChunkSize - 1
+		if end > query.ToBlock || end < start {
+			end = query.ToBlock
+		}
+
+		stored, err := repository.GetEvents(query.Contract, query.Event, start, end)
+		if err != nil {
+			return sent, err
+		}
+
+		for _, storedEvent := range stored {
+			event := StoredEvent(storedEvent, labels[common.HexToAddress(storedEvent.ContractAddress)])
+			if !query.Filter.Match(event) {
+				continue
+			}
+			event.Replay = true
+			event.ReplayID = id
+
+			if err := send(sinks, event); err != nil {
+				return sent, fmt.Errorf("failed to replay event %s: %v", event.Key(), err)
+			}
+			sent++
+		}
+
+		if end == query.ToBlock {
+			break
+		}
+	}
+
+	return sent, nil
+}
@@ -0,0 +1,63 @@
+package listener
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Sink receives every event the listener records, in order. An error stops
+// the current session so the event is retried after reconnecting.
+type Sink interface {
+	Send(event Event) error
+}
+
+type StdoutSink struct{}
+
+func (StdoutSink) Send(event Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s data: %v", event.Name, err)
+	}
+
+	if event.Name != ReorgEvent {
+		fmt.Printf("Contract: %s %s\n", event.Contract.Hex(), event.Label)
+	}
+	fmt.Printf("Log Name: %s\n", event.Name)
+	fmt.Printf("Transaction hash: %s\n", event.TxHash.Hex())
+	fmt.Printf("Block Number: %d\n", event.BlockNumber)
+	fmt.Printf("Block Hash: %s\n", event.BlockHash.Hex())
+	if event.Timestamp != 0 {
+		fmt.Printf("Timestamp: %s\n", time.Unix(int64(event.Timestamp), 0).UTC().Format(time.RFC3339))
+	}
+	if event.Transaction != nil {
+		fmt.Printf("From: %s\n", event.Transaction.From.Hex())
+		fmt.Printf("Gas used: %d\n", event.Transaction.GasUsed)
+		if event.Transaction.EffectiveGasPrice != "" {
+			fmt.Printf("Effective gas price: %s wei\n", event.Transaction.EffectiveGasPrice)
+		}
+	}
+	if event.Replay {
+		fmt.Printf("Replay: %s\n", event.ReplayID)
+	}
+	fmt.Printf("Data: %s\n\n", data)
+	return nil
+}
+
+// emit sends the event to the sinks unless the filter rejects it.
+func (l *Listener) emit(event Event) error {
+	if !l.config.Filter.Match(event) {
+		return nil
+	}
+	return send(l.sinks, event)
+}
+
+func send(sinks []Sink, event Event) error {
+	for _, sink := range sinks {
+		if err := sink.Send(event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"erc-721-checks/internal/checks"
+	"erc-721-checks/internal/models"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// TokenMismatch describes a token owner or balance that differs from the
+// chain. Err is set when the on-chain value could not be read.
+type TokenMismatch struct {
+	Subject string
+	Indexed string
+	OnChain string
+	Err     error
+}
+
+func transferKind(from, to common.Address) string {
+	switch {
+	case from == (common.Address{}):
+		return models.MintTransferKind
+	case to == (common.Address{}):
+		return models.BurnTransferKind
+	default:
+		return models.RegularTransferKind
+	}
+}
+
+func (l *Listener) handleTransfer(event Event, data TransferData) error {
+	transfer := models.Transfer{
+		ContractAddress: event.Contract.Hex(),
+		TxHash:          event.TxHash.Hex(),
+		LogIndex:        event.LogIndex,
+		BlockNumber:     event.BlockNumber,
+		BlockHash:       event.BlockHash.Hex(),
+		From:            data.From.Hex(),
+		To:              data.To.Hex(),
+		TokenID:         data.TokenID,
+		Kind:            data.Kind,
+	}
+
+	if err := l.repositories.Transfers.UpsertTransfer(transfer); err != nil {
+		return fmt.Errorf("failed to store transfer: %v", err)
+	}
+
+	if err := l.repositories.Tokens.ApplyTransfer(transfer); err != nil {
+		return fmt.Errorf("failed to update token owner: %v", err)
+	}
+
+	if transfer.Kind == models.MintTransferKind {
+		if err := l.repositories.Metadata.EnqueueMetadata(transfer.ContractAddress, transfer.TokenID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CheckTokens compares the indexed owners and balances of a contract with
+// OwnerOf and BalanceOf on chain and returns every difference found.
+func CheckTokens(ctx context.Context, client *ethclient.Client, address common.Address, repository *models.TokenRepository) ([]TokenMismatch, error) {
+	opts := &bind.CallOpts{Context: ctx}
+
+	instance, err := checks.NewChecks(address, client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to instantiate contract %s: %v", address.Hex(), err)
+	}
+
+	tokens, err := repository.GetAllTokens(address.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	var mismatches []TokenMismatch
+	for _, token := range tokens {
+		tokenID, ok := new(big.Int).SetString(token.TokenID, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid token id %q", token.TokenID)
+		}
+
+		indexedOwner := common.HexToAddress(token.Owner)
+		owner, err := instance.OwnerOf(opts, tokenID)
+		if err != nil {
+			// OwnerOf reverts for burned tokens.
+			if indexedOwner != (common.Address{}) {
+				mismatches = append(mismatches, TokenMismatch{Subject: "token " + token.TokenID, Indexed: token.Owner, Err: err})
+			}
+			continue
+		}
+
+		if owner != indexedOwner {
+			mismatches = append(mismatches, TokenMismatch{Subject: "token " + token.TokenID, Indexed: token.Owner, OnChain: owner.Hex()})
+		}
+	}
+
+	balances, err := repository.GetBalances(address.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, balance := range balances {
+		onChain, err := instance.BalanceOf(opts, common.HexToAddress(balance.Address))
+		if err != nil {
+			mismatches = append(mismatches, TokenMismatch{Subject: "balance of " + balance.Address, Indexed: fmt.Sprint(balance.Balance), Err: err})
+			continue
+		}
+
+		if !onChain.IsUint64() || onChain.Uint64() != balance.Balance {
+			mismatches = append(mismatches, TokenMismatch{Subject: "balance of " + balance.Address, Indexed: fmt.Sprint(balance.Balance), OnChain: onChain.String()})
+		}
+	}
+
+	return mismatches, nil
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"math/big"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Event listener metrics.
+var (
+	EventsProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "checks_listener_events_processed_total",
+		Help: "Contract events recorded by the event listener.",
+	}, []string{"contract", "event"})
+	HeadLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "checks_listener_head_lag_blocks",
+		Help: "Blocks between the chain head and the last block the event listener processed.",
+	})
+	Reconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "checks_listener_reconnects_total",
+		Help: "Times the event listener redialed the provider after a session failed.",
+	})
+	DecodeErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "checks_listener_decode_errors_total",
+		Help: "Logs the event listener skipped because they could not be decoded.",
+	})
+	EnrichmentsMissing = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "checks_listener_enrichments_missing_total",
+		Help: "Blocks and receipts the provider did not return, whose events were recorded without them.",
+	}, []string{"kind"})
+)
+
+// Admin metrics. The action label is grant, revoke or cancel.
+var (
+	TransactionsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "checks_admin_transactions_sent_total",
+		Help: "Role transactions broadcast by the admin tool.",
+	}, []string{"action"})
+	TransactionsMined = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "checks_admin_transactions_mined_total",
+		Help: "Role transactions mined successfully.",
+	}, []string{"action"})
+	TransactionsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "checks_admin_transactions_failed_total",
+		Help: "Role transactions that could not be sent or were reverted.",
+	}, []string{"action"})
+	TransactionsReplaced = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "checks_admin_transactions_replaced_total",
+		Help: "Stuck transactions sent again with bumped fees.",
+	}, []string{"action"})
+	GasUsed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "checks_admin_gas_used_total",
+		Help: "Gas used by mined role transactions.",
+	})
+	FeesSpent = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "checks_admin_fees_spent_ether_total",
+		Help: "Fees paid for mined role transactions, in ether.",
+	})
+	SignerBalance = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "checks_admin_signer_balance_ether",
+		Help: "Balance of the account signing role transactions, in ether.",
+	})
+)
+
+// Ether converts a wei amount for use as a metric value.
+func Ether(wei *big.Int) float64 {
+	ether, _ := new(big.Float).Quo(new(big.Float).SetInt(wei), big.NewFloat(1e18)).Float64()
+	return ether
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,6 @@
+package models
+
+type Checkpoint struct {
+	ContractAddress string
+	BlockNumber     uint64
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+const (
+	CheckpointsTable                 = "checkpoints"
+	CheckpointsContractAddressColumn = "contract_address"
+	CheckpointsBlockNumberColumn     = "block_number"
+)
+
+type CheckpointRepository struct {
+	db *sql.DB
+}
+
+func NewCheckpointRepository(db *sql.DB) *CheckpointRepository {
+	return &CheckpointRepository{db}
+}
+
+// GetCheckpoint returns nil when nothing has been processed for the contract yet.
+func (cr *CheckpointRepository) GetCheckpoint(contractAddress string) (*Checkpoint, error) {
+	checkpoint := Checkpoint{ContractAddress: contractAddress}
+	err := cr.db.QueryRow(fmt.Sprintf("SELECT %s FROM %s WHERE %s = $1",
+		CheckpointsBlockNumberColumn, CheckpointsTable, CheckpointsContractAddressColumn), contractAddress).Scan(&checkpoint.BlockNumber)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting checkpoint: %v", err)
+	}
+
+	return &checkpoint, nil
+}
+
+func (cr *CheckpointRepository) SaveCheckpoint(checkpoint Checkpoint) error {
+	query := fmt.Sprintf(`INSERT INTO %[1]s (%[2]s, %[3]s) VALUES ($1, $2)
+		ON CONFLICT (%[2]s) DO UPDATE SET %[3]s = EXCLUDED.%[3]s`,
+		CheckpointsTable, CheckpointsContractAddressColumn, CheckpointsBlockNumberColumn)
+
+	if _, err := cr.db.Exec(query, checkpoint.ContractAddress, checkpoint.BlockNumber); err != nil {
+		return fmt.Errorf("error saving checkpoint: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,18 @@
+package models
+
+type Event struct {
+	ID              int64
+	ContractAddress string
+	Name            string
+	TxHash          string
+	LogIndex        uint
+	BlockNumber     uint64
+	BlockHash       string
+	// BlockTimestamp and the transaction details are empty for events stored
+	// before they were recorded.
+	BlockTimestamp    uint64
+	TxFrom            string
+	GasUsed           uint64
+	EffectiveGasPrice string
+	Data              string
+}
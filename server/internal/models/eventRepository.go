@@ -0,0 +1,135 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+const (
+	EventsTable             = "events"
+	EventsIDColumn          = "id"
+	EventsContractColumn    = "contract_address"
+	EventsNameColumn        = "event_name"
+	EventsTxHashColumn      = "tx_hash"
+	EventsLogIndexColumn    = "log_index"
+	EventsBlockNumberColumn = "block_number"
+	EventsBlockHashColumn   = "block_hash"
+	EventsTimestampColumn   = "block_timestamp"
+	EventsTxFromColumn      = "tx_from"
+	EventsGasUsedColumn     = "gas_used"
+	EventsGasPriceColumn    = "effective_gas_price"
+	EventsDataColumn        = "data"
+)
+
+var eventColumns = strings.Join([]string{
+	EventsIDColumn, EventsContractColumn, EventsNameColumn, EventsTxHashColumn, EventsLogIndexColumn,
+	EventsBlockNumberColumn, EventsBlockHashColumn,
+	fmt.Sprintf("COALESCE(%s, 0)", EventsTimestampColumn), fmt.Sprintf("COALESCE(%s, '')", EventsTxFromColumn),
+	fmt.Sprintf("COALESCE(%s, 0)", EventsGasUsedColumn), fmt.Sprintf("COALESCE(%s::TEXT, '')", EventsGasPriceColumn),
+	EventsDataColumn,
+}, ", ")
+
+type EventRepository struct {
+	db *sql.DB
+}
+
+func NewEventRepository(db *sql.DB) *EventRepository {
+	return &EventRepository{db}
+}
+
+// UpsertEvent stores the event and returns its id. An event stored again keeps
+// the id it was first given.
+func (er *EventRepository) UpsertEvent(event Event) (int64, error) {
+	query := fmt.Sprintf(`INSERT INTO %[1]s (%[2]s, %[3]s, %[4]s, %[5]s, %[6]s, %[7]s, %[8]s, %[10]s, %[11]s, %[12]s, %[13]s)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8::BIGINT, 0), NULLIF($9, ''), NULLIF($10::BIGINT, 0), NULLIF($11, '')::NUMERIC)
+		ON CONFLICT (%[4]s, %[5]s) DO UPDATE SET
+			%[2]s = EXCLUDED.%[2]s,
+			%[3]s = EXCLUDED.%[3]s,
+			%[6]s = EXCLUDED.%[6]s,
+			%[7]s = EXCLUDED.%[7]s,
+			%[8]s = EXCLUDED.%[8]s,
+			%[10]s = EXCLUDED.%[10]s,
+			%[11]s = EXCLUDED.%[11]s,
+			%[12]s = EXCLUDED.%[12]s,
+			%[13]s = EXCLUDED.%[13]s
+		RETURNING %[9]s`,
+		EventsTable, EventsContractColumn, EventsNameColumn, EventsTxHashColumn, EventsLogIndexColumn,
+		EventsBlockNumberColumn, EventsBlockHashColumn, EventsDataColumn, EventsIDColumn,
+		EventsTimestampColumn, EventsTxFromColumn, EventsGasUsedColumn, EventsGasPriceColumn)
+
+	var id int64
+	if err := er.db.QueryRow(query, event.ContractAddress, event.Name, event.TxHash, event.LogIndex,
+		event.BlockNumber, event.BlockHash, event.Data, event.BlockTimestamp, event.TxFrom, event.GasUsed,
+		event.EffectiveGasPrice).Scan(&id); err != nil {
+		return 0, fmt.Errorf("error upserting %s event: %v", event.Name, err)
+	}
+
+	return id, nil
+}
+
+// GetEvents returns the stored events between two blocks inclusive in chain
+// order. An empty contract address or event name matches every one.
+func (er *EventRepository) GetEvents(contractAddress, name string, fromBlock, toBlock uint64) ([]Event, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s BETWEEN $1 AND $2",
+		eventColumns, EventsTable, EventsBlockNumberColumn)
+	args := []interface{}{fromBlock, toBlock}
+	if contractAddress != "" {
+		args = append(args, contractAddress)
+		query += fmt.Sprintf(" AND %s = $%d", EventsContractColumn, len(args))
+	}
+	if name != "" {
+		args = append(args, name)
+		query += fmt.Sprintf(" AND %s = $%d", EventsNameColumn, len(args))
+	}
+	query += fmt.Sprintf(" ORDER BY %s, %s", EventsBlockNumberColumn, EventsLogIndexColumn)
+
+	return er.queryEvents(query, args...)
+}
+
+// GetEventsAfter returns up to limit stored events with an id above afterID,
+// lowest id first.
+func (er *EventRepository) GetEventsAfter(afterID int64, limit int) ([]Event, error) {
+	return er.queryEvents(fmt.Sprintf("SELECT %s FROM %s WHERE %s > $1 ORDER BY %s LIMIT $2",
+		eventColumns, EventsTable, EventsIDColumn, EventsIDColumn), afterID, limit)
+}
+
+func (er *EventRepository) queryEvents(query string, args ...interface{}) ([]Event, error) {
+	rows, err := er.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting events: %v", err)
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var event Event
+		if err := rows.Scan(&event.ID, &event.ContractAddress, &event.Name, &event.TxHash, &event.LogIndex,
+			&event.BlockNumber, &event.BlockHash, &event.BlockTimestamp, &event.TxFrom, &event.GasUsed,
+			&event.EffectiveGasPrice, &event.Data); err != nil {
+			return nil, fmt.Errorf("error scanning event: %v", err)
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through events: %v", err)
+	}
+
+	return events, nil
+}
+
+func (er *EventRepository) DeleteEventsFromBlock(contractAddress string, blockNumber uint64) (int64, error) {
+	result, err := er.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s = $1 AND %s >= $2",
+		EventsTable, EventsContractColumn, EventsBlockNumberColumn), contractAddress, blockNumber)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting events from block %d: %v", blockNumber, err)
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error counting deleted events: %v", err)
+	}
+
+	return removed, nil
+}
@@ -1,6 +1,9 @@
 package models
 
 type Minter struct {
-	Address string
-	Status  int
+	Address     string
+	Status      int
+	Label       string
+	BlockNumber uint64
+	TxHash      string
 }
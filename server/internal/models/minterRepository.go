@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/lib/pq"
 )
 
@@ -13,6 +14,9 @@ const (
 	MintersIDColumn      = "id"
 	MintersAddressColumn = "address"
 	MintersStatusColumn  = "status"
+	MintersLabelColumn   = "label"
+	MintersBlockColumn   = "block_number"
+	MintersTxHashColumn  = "tx_hash"
 	ActiveMinterStatus   = 1
 	ArchivedMinterStatus = 0
 )
@@ -37,7 +41,7 @@ func (mr *MinterRepository) InitializeMintersTable(minters []Minter) error {
 	)
 	for _, minter := range minters {
 		valueStrings = append(valueStrings, fmt.Sprintf("($%d, $%d)", placeholderIndex, placeholderIndex+1))
-		values = append(values, minter.Address, minter.Status)
+		values = append(values, normalizeAddress(minter.Address), minter.Status)
 		placeholderIndex += 2
 	}
 
@@ -52,6 +56,7 @@ func (mr *MinterRepository) InitializeMintersTable(minters []Minter) error {
 }
 
 func (mr *MinterRepository) CreateMinter(address string, status int) error {
+	address = normalizeAddress(address)
 	if _, err := mr.db.Exec(fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES ($1, $2)", MintersTable, MintersAddressColumn, MintersStatusColumn), address, status); err != nil {
 		pgErr, ok := err.(*pq.Error)
 		if ok && pgErr.Code == "23505" {
@@ -65,14 +70,66 @@ func (mr *MinterRepository) CreateMinter(address string, status int) error {
 	return nil
 }
 
+// UpsertMinter creates the minter or updates its status. The label is only
+// changed when one is given.
+func (mr *MinterRepository) UpsertMinter(minter Minter) error {
+	query := fmt.Sprintf(`INSERT INTO %[1]s (%[2]s, %[3]s, %[4]s) VALUES ($1, $2, NULLIF($3, ''))
+		ON CONFLICT ((lower(%[2]s))) DO UPDATE SET
+			%[3]s = EXCLUDED.%[3]s,
+			%[4]s = COALESCE(EXCLUDED.%[4]s, %[1]s.%[4]s)`,
+		MintersTable, MintersAddressColumn, MintersStatusColumn, MintersLabelColumn)
+
+	if _, err := mr.db.Exec(query, normalizeAddress(minter.Address), minter.Status, minter.Label); err != nil {
+		return fmt.Errorf("error upserting minter: %v", err)
+	}
+
+	return nil
+}
+
 func (mr *MinterRepository) UpdateMinter(address string, status int) error {
-	if _, err := mr.db.Exec(fmt.Sprintf("UPDATE %s SET %s = $1 WHERE %s = $2", MintersTable, MintersStatusColumn, MintersAddressColumn), status, address); err != nil {
+	if _, err := mr.db.Exec(fmt.Sprintf("UPDATE %s SET %s = $1 WHERE lower(%s) = lower($2)", MintersTable, MintersStatusColumn, MintersAddressColumn), status, normalizeAddress(address)); err != nil {
 		return fmt.Errorf("error updating minter status: %v", err)
 	}
 
 	return nil
 }
 
+// GetMinter returns the stored status and label of the minter, and whether it
+// is stored at all.
+func (mr *MinterRepository) GetMinter(address string) (Minter, bool, error) {
+	minter := Minter{Address: normalizeAddress(address)}
+	err := mr.db.QueryRow(fmt.Sprintf("SELECT %s, COALESCE(%s, '') FROM %s WHERE lower(%s) = lower($1)",
+		MintersStatusColumn, MintersLabelColumn, MintersTable, MintersAddressColumn), minter.Address).Scan(&minter.Status, &minter.Label)
+	if err == sql.ErrNoRows {
+		return Minter{}, false, nil
+	}
+	if err != nil {
+		return Minter{}, false, fmt.Errorf("error getting minter %s: %v", address, err)
+	}
+
+	return minter, true, nil
+}
+
+// RestoreMinter overwrites the status and label with those returned by
+// GetMinter, clearing the label when the minter had none.
+func (mr *MinterRepository) RestoreMinter(minter Minter) error {
+	if _, err := mr.db.Exec(fmt.Sprintf("UPDATE %s SET %s = $1, %s = NULLIF($2, '') WHERE lower(%s) = lower($3)",
+		MintersTable, MintersStatusColumn, MintersLabelColumn, MintersAddressColumn),
+		minter.Status, minter.Label, normalizeAddress(minter.Address)); err != nil {
+		return fmt.Errorf("error restoring minter %s: %v", minter.Address, err)
+	}
+
+	return nil
+}
+
+func (mr *MinterRepository) DeleteMinter(address string) error {
+	if _, err := mr.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE lower(%s) = lower($1)", MintersTable, MintersAddressColumn), normalizeAddress(address)); err != nil {
+		return fmt.Errorf("error deleting minter %s: %v", address, err)
+	}
+
+	return nil
+}
+
 func (mr *MinterRepository) GetAllMinters() ([]Minter, error) {
 	rows, err := mr.db.Query(fmt.Sprintf("SELECT %s, %s FROM %s", MintersAddressColumn, MintersStatusColumn, MintersTable))
 	if err != nil {
@@ -95,3 +152,73 @@ func (mr *MinterRepository) GetAllMinters() ([]Minter, error) {
 
 	return minters, nil
 }
+
+// ApplyRoleChange records a status change caused by an on-chain role event.
+// Changes older than the one already recorded for the minter are ignored.
+func (mr *MinterRepository) ApplyRoleChange(minter Minter) (bool, error) {
+	query := fmt.Sprintf(`INSERT INTO %[1]s (%[2]s, %[3]s, %[4]s, %[5]s) VALUES ($1, $2, $3, $4)
+		ON CONFLICT ((lower(%[2]s))) DO UPDATE SET
+			%[3]s = EXCLUDED.%[3]s,
+			%[4]s = EXCLUDED.%[4]s,
+			%[5]s = EXCLUDED.%[5]s
+		WHERE %[1]s.%[4]s IS NULL OR %[1]s.%[4]s <= EXCLUDED.%[4]s`,
+		MintersTable, MintersAddressColumn, MintersStatusColumn, MintersBlockColumn, MintersTxHashColumn)
+
+	result, err := mr.db.Exec(query, normalizeAddress(minter.Address), minter.Status, minter.BlockNumber, minter.TxHash)
+	if err != nil {
+		return false, fmt.Errorf("error applying minter role change: %v", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error counting updated minters: %v", err)
+	}
+
+	return updated > 0, nil
+}
+
+// ResetRoleChange overwrites the recorded status unconditionally and clears the
+// transaction that caused it, e.g. after that transaction was orphaned.
+func (mr *MinterRepository) ResetRoleChange(minter Minter) error {
+	if _, err := mr.db.Exec(fmt.Sprintf("UPDATE %s SET %s = $1, %s = $2, %s = NULL WHERE lower(%s) = lower($3)",
+		MintersTable, MintersStatusColumn, MintersBlockColumn, MintersTxHashColumn, MintersAddressColumn),
+		minter.Status, minter.BlockNumber, normalizeAddress(minter.Address)); err != nil {
+		return fmt.Errorf("error resetting minter status: %v", err)
+	}
+
+	return nil
+}
+
+func (mr *MinterRepository) GetMintersChangedFromBlock(blockNumber uint64) ([]Minter, error) {
+	rows, err := mr.db.Query(fmt.Sprintf("SELECT %s, %s FROM %s WHERE %s >= $1",
+		MintersAddressColumn, MintersStatusColumn, MintersTable, MintersBlockColumn), blockNumber)
+	if err != nil {
+		return nil, fmt.Errorf("error getting minters changed from block %d: %v", blockNumber, err)
+	}
+	defer rows.Close()
+
+	var minters []Minter
+	for rows.Next() {
+		var minter Minter
+		if err := rows.Scan(&minter.Address, &minter.Status); err != nil {
+			return nil, fmt.Errorf("error scanning minter: %v", err)
+		}
+		minters = append(minters, minter)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through minters: %v", err)
+	}
+
+	return minters, nil
+}
+
+// normalizeAddress stores addresses checksummed, as the listener receives
+// them. Rows stored before may be in any case, so addresses are compared and
+// kept unique case-insensitively.
+func normalizeAddress(address string) string {
+	if !common.IsHexAddress(address) {
+		return address
+	}
+	return common.HexToAddress(address).Hex()
+}
@@ -0,0 +1,17 @@
+package models
+
+type Token struct {
+	ContractAddress string
+	TokenID         string
+	Owner           string
+	MintedBlock     uint64
+	MintTxHash      string
+	LastBlock       uint64
+	LastLogIndex    uint
+}
+
+type Balance struct {
+	ContractAddress string
+	Address         string
+	Balance         uint64
+}
@@ -0,0 +1,11 @@
+package models
+
+type TokenMetadata struct {
+	ContractAddress string
+	TokenID         string
+	URI             string
+	Metadata        string
+	Status          int
+	Attempts        int
+	LastError       string
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	TokenMetadataTable               = "token_metadata"
+	TokenMetadataContractColumn      = "contract_address"
+	TokenMetadataTokenIDColumn       = "token_id"
+	TokenMetadataURIColumn           = "uri"
+	TokenMetadataMetadataColumn      = "metadata"
+	TokenMetadataStatusColumn        = "status"
+	TokenMetadataAttemptsColumn      = "attempts"
+	TokenMetadataLastErrorColumn     = "last_error"
+	TokenMetadataNextAttemptAtColumn = "next_attempt_at"
+	TokenMetadataResolvedAtColumn    = "resolved_at"
+	PendingMetadataStatus            = 0
+	ResolvedMetadataStatus           = 1
+	InvalidMetadataStatus            = 2
+	FailedMetadataStatus             = 3
+)
+
+type TokenMetadataRepository struct {
+	db *sql.DB
+}
+
+func NewTokenMetadataRepository(db *sql.DB) *TokenMetadataRepository {
+	return &TokenMetadataRepository{db}
+}
+
+// EnqueueMetadata queues the token for metadata resolution unless it is
+// already queued or resolved.
+func (tr *TokenMetadataRepository) EnqueueMetadata(contractAddress, tokenID string) error {
+	if _, err := tr.db.Exec(fmt.Sprintf("INSERT INTO %[1]s (%[2]s, %[3]s) VALUES ($1, $2) ON CONFLICT (%[2]s, %[3]s) DO NOTHING",
+		TokenMetadataTable, TokenMetadataContractColumn, TokenMetadataTokenIDColumn), contractAddress, tokenID); err != nil {
+		return fmt.Errorf("error queueing metadata for token %s: %v", tokenID, err)
+	}
+
+	return nil
+}
+
+func (tr *TokenMetadataRepository) GetDueMetadata(limit int) ([]TokenMetadata, error) {
+	rows, err := tr.db.Query(fmt.Sprintf("SELECT %s, %s, COALESCE(%s, ''), %s FROM %s WHERE %s = $1 AND %s <= NOW() ORDER BY %s LIMIT $2",
+		TokenMetadataContractColumn, TokenMetadataTokenIDColumn, TokenMetadataURIColumn, TokenMetadataAttemptsColumn, TokenMetadataTable,
+		TokenMetadataStatusColumn, TokenMetadataNextAttemptAtColumn, TokenMetadataNextAttemptAtColumn),
+		PendingMetadataStatus, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting queued metadata: %v", err)
+	}
+	defer rows.Close()
+
+	var queue []TokenMetadata
+	for rows.Next() {
+		metadata := TokenMetadata{Status: PendingMetadataStatus}
+		if err := rows.Scan(&metadata.ContractAddress, &metadata.TokenID, &metadata.URI, &metadata.Attempts); err != nil {
+			return nil, fmt.Errorf("error scanning queued metadata: %v", err)
+		}
+		queue = append(queue, metadata)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through queued metadata: %v", err)
+	}
+
+	return queue, nil
+}
+
+func (tr *TokenMetadataRepository) SaveMetadata(metadata TokenMetadata) error {
+	if _, err := tr.db.Exec(fmt.Sprintf("UPDATE %s SET %s = $1, %s = $2, %s = $3, %s = $4, %s = NULL, %s = NOW() WHERE %s = $5 AND %s = $6",
+		TokenMetadataTable, TokenMetadataURIColumn, TokenMetadataMetadataColumn, TokenMetadataStatusColumn,
+		TokenMetadataAttemptsColumn, TokenMetadataLastErrorColumn, TokenMetadataResolvedAtColumn,
+		TokenMetadataContractColumn, TokenMetadataTokenIDColumn),
+		metadata.URI, metadata.Metadata, ResolvedMetadataStatus, metadata.Attempts, metadata.ContractAddress, metadata.TokenID); err != nil {
+		return fmt.Errorf("error saving metadata for token %s: %v", metadata.TokenID, err)
+	}
+
+	return nil
+}
+
+// MarkAttemptFailed records a failed resolution. Pending entries are retried
+// at nextAttemptAt; invalid and failed ones are left alone.
+func (tr *TokenMetadataRepository) MarkAttemptFailed(metadata TokenMetadata, nextAttemptAt time.Time) error {
+	if _, err := tr.db.Exec(fmt.Sprintf("UPDATE %s SET %s = $1, %s = $2, %s = $3, %s = $4, %s = $5 WHERE %s = $6 AND %s = $7",
+		TokenMetadataTable, TokenMetadataURIColumn, TokenMetadataStatusColumn, TokenMetadataAttemptsColumn,
+		TokenMetadataLastErrorColumn, TokenMetadataNextAttemptAtColumn, TokenMetadataContractColumn, TokenMetadataTokenIDColumn),
+		metadata.URI, metadata.Status, metadata.Attempts, metadata.LastError, nextAttemptAt, metadata.ContractAddress, metadata.TokenID); err != nil {
+		return fmt.Errorf("error recording failed metadata for token %s: %v", metadata.TokenID, err)
+	}
+
+	return nil
+}
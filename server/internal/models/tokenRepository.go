@@ -0,0 +1,160 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+const (
+	TokensTable              = "tokens"
+	TokensContractColumn     = "contract_address"
+	TokensTokenIDColumn      = "token_id"
+	TokensOwnerColumn        = "owner"
+	TokensMintedBlockColumn  = "minted_block"
+	TokensMintTxHashColumn   = "mint_tx_hash"
+	TokensLastBlockColumn    = "last_block"
+	TokensLastLogIndexColumn = "last_log_index"
+	BalancesView             = "balances"
+	BalancesContractColumn   = "contract_address"
+	BalancesAddressColumn    = "address"
+	BalancesBalanceColumn    = "balance"
+)
+
+var tokenColumns = fmt.Sprintf("%s, %s, %s, COALESCE(%s, 0), COALESCE(%s, ''), %s, %s",
+	TokensContractColumn, TokensTokenIDColumn, TokensOwnerColumn, TokensMintedBlockColumn,
+	TokensMintTxHashColumn, TokensLastBlockColumn, TokensLastLogIndexColumn)
+
+type TokenRepository struct {
+	db *sql.DB
+}
+
+func NewTokenRepository(db *sql.DB) *TokenRepository {
+	return &TokenRepository{db}
+}
+
+// ApplyTransfer moves the token to the transfer's recipient. Transfers older
+// than the last one applied to the token are ignored, so redelivered logs
+// cannot roll the owner back.
+func (tr *TokenRepository) ApplyTransfer(transfer Transfer) error {
+	var mintedBlock, mintTxHash interface{}
+	if transfer.Kind == MintTransferKind {
+		mintedBlock, mintTxHash = transfer.BlockNumber, transfer.TxHash
+	}
+
+	query := fmt.Sprintf(`INSERT INTO %[1]s (%[2]s, %[3]s, %[4]s, %[5]s, %[6]s, %[7]s, %[8]s)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (%[2]s, %[3]s) DO UPDATE SET
+			%[4]s = EXCLUDED.%[4]s,
+			%[5]s = COALESCE(EXCLUDED.%[5]s, %[1]s.%[5]s),
+			%[6]s = COALESCE(EXCLUDED.%[6]s, %[1]s.%[6]s),
+			%[7]s = EXCLUDED.%[7]s,
+			%[8]s = EXCLUDED.%[8]s
+		WHERE (%[1]s.%[7]s, %[1]s.%[8]s) <= (EXCLUDED.%[7]s, EXCLUDED.%[8]s)`,
+		TokensTable, TokensContractColumn, TokensTokenIDColumn, TokensOwnerColumn, TokensMintedBlockColumn,
+		TokensMintTxHashColumn, TokensLastBlockColumn, TokensLastLogIndexColumn)
+
+	if _, err := tr.db.Exec(query, transfer.ContractAddress, transfer.TokenID, transfer.To, mintedBlock, mintTxHash,
+		transfer.BlockNumber, transfer.LogIndex); err != nil {
+		return fmt.Errorf("error applying transfer to token %s: %v", transfer.TokenID, err)
+	}
+
+	return nil
+}
+
+// RollbackFromBlock rebuilds every token of the contract touched at or above
+// the given block from the transfers that are still stored. It has to run
+// after the orphaned transfers were deleted.
+func (tr *TokenRepository) RollbackFromBlock(contractAddress string, blockNumber uint64) error {
+	tx, err := tr.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting token rollback: %v", err)
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		fmt.Sprintf(`DELETE FROM %[1]s WHERE %[2]s = $1 AND %[3]s >= $2
+			AND NOT EXISTS (SELECT 1 FROM %[4]s WHERE %[4]s.%[5]s = %[1]s.%[2]s AND %[4]s.%[6]s = %[1]s.%[7]s)`,
+			TokensTable, TokensContractColumn, TokensLastBlockColumn,
+			TransfersTable, TransfersContractColumn, TransfersTokenIDColumn, TokensTokenIDColumn),
+		fmt.Sprintf(`UPDATE %[1]s SET %[3]s = NULL, %[4]s = NULL WHERE %[2]s = $1 AND %[3]s >= $2`,
+			TokensTable, TokensContractColumn, TokensMintedBlockColumn, TokensMintTxHashColumn),
+		fmt.Sprintf(`UPDATE %[1]s SET %[3]s = latest.%[7]s, %[4]s = latest.%[8]s, %[5]s = latest.%[9]s
+			FROM (SELECT DISTINCT ON (%[10]s) %[10]s, %[7]s, %[8]s, %[9]s FROM %[11]s WHERE %[12]s = $1
+				ORDER BY %[10]s, %[8]s DESC, %[9]s DESC) latest
+			WHERE %[1]s.%[2]s = $1 AND %[1]s.%[6]s = latest.%[10]s AND %[1]s.%[4]s >= $2`,
+			TokensTable, TokensContractColumn, TokensOwnerColumn, TokensLastBlockColumn, TokensLastLogIndexColumn,
+			TokensTokenIDColumn, TransfersToColumn, TransfersBlockNumberColumn, TransfersLogIndexColumn,
+			TransfersTokenIDColumn, TransfersTable, TransfersContractColumn),
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, contractAddress, blockNumber); err != nil {
+			return fmt.Errorf("error rolling back tokens from block %d: %v", blockNumber, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing token rollback: %v", err)
+	}
+
+	return nil
+}
+
+func (tr *TokenRepository) GetAllTokens(contractAddress string) ([]Token, error) {
+	return tr.queryTokens(fmt.Sprintf("SELECT %s FROM %s WHERE %s = $1 ORDER BY %s",
+		tokenColumns, TokensTable, TokensContractColumn, TokensTokenIDColumn), contractAddress)
+}
+
+func (tr *TokenRepository) GetTokensByOwner(owner string) ([]Token, error) {
+	return tr.queryTokens(fmt.Sprintf("SELECT %s FROM %s WHERE %s = $1 ORDER BY %s, %s",
+		tokenColumns, TokensTable, TokensOwnerColumn, TokensContractColumn, TokensTokenIDColumn), owner)
+}
+
+func (tr *TokenRepository) GetBalances(contractAddress string) ([]Balance, error) {
+	rows, err := tr.db.Query(fmt.Sprintf("SELECT %s, %s, %s FROM %s WHERE %s = $1 ORDER BY %s",
+		BalancesContractColumn, BalancesAddressColumn, BalancesBalanceColumn, BalancesView,
+		BalancesContractColumn, BalancesAddressColumn), contractAddress)
+	if err != nil {
+		return nil, fmt.Errorf("error getting balances: %v", err)
+	}
+	defer rows.Close()
+
+	var balances []Balance
+	for rows.Next() {
+		var balance Balance
+		if err := rows.Scan(&balance.ContractAddress, &balance.Address, &balance.Balance); err != nil {
+			return nil, fmt.Errorf("error scanning balance: %v", err)
+		}
+		balances = append(balances, balance)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through balances: %v", err)
+	}
+
+	return balances, nil
+}
+
+func (tr *TokenRepository) queryTokens(query string, args ...interface{}) ([]Token, error) {
+	rows, err := tr.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting tokens: %v", err)
+	}
+	defer rows.Close()
+
+	var tokens []Token
+	for rows.Next() {
+		var token Token
+		if err := rows.Scan(&token.ContractAddress, &token.TokenID, &token.Owner, &token.MintedBlock,
+			&token.MintTxHash, &token.LastBlock, &token.LastLogIndex); err != nil {
+			return nil, fmt.Errorf("error scanning token: %v", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through tokens: %v", err)
+	}
+
+	return tokens, nil
+}
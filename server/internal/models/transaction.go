@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Transaction is a transaction sent by the admin tooling. Payload is the
+// signed transaction, hex encoded, so it can be broadcast again.
+type Transaction struct {
+	ID          int64
+	ChainID     int64
+	Sender      string
+	Nonce       uint64
+	Hash        string
+	Action      string
+	Target      string
+	Payload     string
+	Status      int
+	BlockNumber uint64
+	LastError   string
+	CreatedAt   time.Time
+}
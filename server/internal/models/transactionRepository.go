@@ -0,0 +1,271 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+const (
+	TransactionsTable             = "transactions"
+	TransactionsIDColumn          = "id"
+	TransactionsChainIDColumn     = "chain_id"
+	TransactionsSenderColumn      = "sender"
+	TransactionsNonceColumn       = "nonce"
+	TransactionsHashColumn        = "tx_hash"
+	TransactionsActionColumn      = "action"
+	TransactionsTargetColumn      = "target"
+	TransactionsPayloadColumn     = "payload"
+	TransactionsStatusColumn      = "status"
+	TransactionsBlockNumberColumn = "block_number"
+	TransactionsLastErrorColumn   = "last_error"
+	TransactionsCreatedAtColumn   = "created_at"
+	TransactionsUpdatedAtColumn   = "updated_at"
+	PendingTransactionStatus      = 0
+	MinedTransactionStatus        = 1
+	FailedTransactionStatus       = 2
+	// ReplacedTransactionStatus is set when another transaction with the same
+	// nonce was mined.
+	ReplacedTransactionStatus = 3
+	// DroppedTransactionStatus is set when the transaction never made it to
+	// the chain.
+	DroppedTransactionStatus = 4
+)
+
+var transactionColumns = strings.Join([]string{
+	TransactionsIDColumn, TransactionsChainIDColumn, TransactionsSenderColumn, TransactionsNonceColumn,
+	TransactionsHashColumn, TransactionsActionColumn, fmt.Sprintf("COALESCE(%s, '')", TransactionsTargetColumn),
+	TransactionsPayloadColumn, TransactionsStatusColumn, fmt.Sprintf("COALESCE(%s, 0)", TransactionsBlockNumberColumn),
+	fmt.Sprintf("COALESCE(%s, '')", TransactionsLastErrorColumn), TransactionsCreatedAtColumn,
+}, ", ")
+
+type TransactionRepository struct {
+	db *sql.DB
+}
+
+func NewTransactionRepository(db *sql.DB) *TransactionRepository {
+	return &TransactionRepository{db}
+}
+
+// ReserveNonce stores the transaction returned by build while holding an
+// advisory lock for the sender, so that processes sharing a signer never
+// build transactions for the same nonce. build gets the nonces of the
+// sender's pending transactions.
+func (tr *TransactionRepository) ReserveNonce(chainID int64, sender string, build func(pending map[uint64]bool) (Transaction, error)) (Transaction, error) {
+	tx, err := tr.db.Begin()
+	if err != nil {
+		return Transaction{}, fmt.Errorf("error starting nonce reservation: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", senderLockKey(chainID, sender)); err != nil {
+		return Transaction{}, fmt.Errorf("error locking nonces of %s: %v", sender, err)
+	}
+
+	rows, err := tx.Query(fmt.Sprintf("SELECT %s FROM %s WHERE %s = $1 AND %s = $2 AND %s = $3",
+		TransactionsNonceColumn, TransactionsTable, TransactionsChainIDColumn, TransactionsSenderColumn,
+		TransactionsStatusColumn), chainID, sender, PendingTransactionStatus)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("error getting pending nonces: %v", err)
+	}
+	pending := make(map[uint64]bool)
+	for rows.Next() {
+		var nonce uint64
+		if err := rows.Scan(&nonce); err != nil {
+			rows.Close()
+			return Transaction{}, fmt.Errorf("error scanning pending nonce: %v", err)
+		}
+		pending[nonce] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return Transaction{}, fmt.Errorf("error getting pending nonces: %v", err)
+	}
+
+	transaction, err := build(pending)
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	transaction.ChainID, transaction.Sender = chainID, sender
+	if transaction, err = insertTransaction(tx, transaction); err != nil {
+		return Transaction{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Transaction{}, fmt.Errorf("error committing nonce reservation: %v", err)
+	}
+
+	return transaction, nil
+}
+
+// ReplaceTransaction stores the transaction returned by build as the
+// replacement of replaced while holding the sender's advisory lock, so
+// processes and goroutines waiting for the same nonce never replace it twice.
+// When replaced is no longer the nonce's latest transaction that was not
+// dropped, build is not called and that latest transaction is returned with
+// false.
+func (tr *TransactionRepository) ReplaceTransaction(chainID int64, sender string, nonce uint64, replaced string, build func() (Transaction, error)) (Transaction, bool, error) {
+	tx, err := tr.db.Begin()
+	if err != nil {
+		return Transaction{}, false, fmt.Errorf("error starting replacement: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", senderLockKey(chainID, sender)); err != nil {
+		return Transaction{}, false, fmt.Errorf("error locking nonces of %s: %v", sender, err)
+	}
+
+	latest, err := scanTransaction(tx.QueryRow(fmt.Sprintf("SELECT %s FROM %s WHERE %s = $1 AND %s = $2 AND %s = $3 AND %s <> $4 ORDER BY %s DESC LIMIT 1",
+		transactionColumns, TransactionsTable, TransactionsChainIDColumn, TransactionsSenderColumn, TransactionsNonceColumn,
+		TransactionsStatusColumn, TransactionsIDColumn), chainID, sender, nonce, DroppedTransactionStatus))
+	if err == sql.ErrNoRows {
+		return Transaction{}, false, fmt.Errorf("no transaction stored with nonce %d", nonce)
+	}
+	if err != nil {
+		return Transaction{}, false, err
+	}
+	if latest.Hash != replaced {
+		return latest, false, nil
+	}
+
+	transaction, err := build()
+	if err != nil {
+		return Transaction{}, false, err
+	}
+
+	transaction.ChainID, transaction.Sender = chainID, sender
+	if transaction, err = insertTransaction(tx, transaction); err != nil {
+		return Transaction{}, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Transaction{}, false, fmt.Errorf("error committing replacement: %v", err)
+	}
+
+	return transaction, true, nil
+}
+
+// CreateTransaction stores a transaction for a nonce the sender already
+// reserved, such as a cancellation.
+func (tr *TransactionRepository) CreateTransaction(transaction Transaction) (Transaction, error) {
+	return insertTransaction(tr.db, transaction)
+}
+
+// insertTransaction stores the transaction as pending, either directly or as
+// part of a database transaction.
+func insertTransaction(db interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}, transaction Transaction) (Transaction, error) {
+	query := fmt.Sprintf(`INSERT INTO %s (%s, %s, %s, %s, %s, %s, %s, %s) VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8)
+		RETURNING %s, %s`,
+		TransactionsTable, TransactionsChainIDColumn, TransactionsSenderColumn, TransactionsNonceColumn,
+		TransactionsHashColumn, TransactionsActionColumn, TransactionsTargetColumn, TransactionsPayloadColumn,
+		TransactionsStatusColumn, TransactionsIDColumn, TransactionsCreatedAtColumn)
+	if err := db.QueryRow(query, transaction.ChainID, transaction.Sender, transaction.Nonce, transaction.Hash,
+		transaction.Action, transaction.Target, transaction.Payload, PendingTransactionStatus).Scan(&transaction.ID, &transaction.CreatedAt); err != nil {
+		return Transaction{}, fmt.Errorf("error storing transaction %s: %v", transaction.Hash, err)
+	}
+
+	transaction.Status = PendingTransactionStatus
+	return transaction, nil
+}
+
+// UpdateTransactionStatus records the outcome of a transaction. The block
+// number is only stored when it is not 0.
+func (tr *TransactionRepository) UpdateTransactionStatus(hash string, status int, blockNumber uint64, lastError string) error {
+	query := fmt.Sprintf("UPDATE %s SET %s = $1, %s = NULLIF($2, 0), %s = NULLIF($3, ''), %s = NOW() WHERE %s = $4",
+		TransactionsTable, TransactionsStatusColumn, TransactionsBlockNumberColumn, TransactionsLastErrorColumn,
+		TransactionsUpdatedAtColumn, TransactionsHashColumn)
+
+	if _, err := tr.db.Exec(query, status, int64(blockNumber), lastError, hash); err != nil {
+		return fmt.Errorf("error updating transaction %s: %v", hash, err)
+	}
+
+	return nil
+}
+
+// ReplaceNonce marks the sender's other pending transactions with the nonce
+// as replaced once hash was mined with it.
+func (tr *TransactionRepository) ReplaceNonce(chainID int64, sender string, nonce uint64, hash string) error {
+	query := fmt.Sprintf("UPDATE %s SET %s = $1, %s = NOW() WHERE %s = $2 AND %s = $3 AND %s = $4 AND %s = $5 AND %s <> $6",
+		TransactionsTable, TransactionsStatusColumn, TransactionsUpdatedAtColumn, TransactionsChainIDColumn,
+		TransactionsSenderColumn, TransactionsNonceColumn, TransactionsStatusColumn, TransactionsHashColumn)
+
+	if _, err := tr.db.Exec(query, ReplacedTransactionStatus, chainID, sender, nonce, PendingTransactionStatus, hash); err != nil {
+		return fmt.Errorf("error replacing transactions with nonce %d: %v", nonce, err)
+	}
+
+	return nil
+}
+
+// GetPendingTransactions returns the sender's pending transactions ordered by
+// nonce.
+func (tr *TransactionRepository) GetPendingTransactions(chainID int64, sender string) ([]Transaction, error) {
+	return tr.queryTransactions(fmt.Sprintf("SELECT %s FROM %s WHERE %s = $1 AND %s = $2 AND %s = $3 ORDER BY %s, %s",
+		transactionColumns, TransactionsTable, TransactionsChainIDColumn, TransactionsSenderColumn,
+		TransactionsStatusColumn, TransactionsNonceColumn, TransactionsIDColumn), chainID, sender, PendingTransactionStatus)
+}
+
+// GetTransactionsByNonce returns every transaction the sender stored for the
+// nonce, oldest first.
+func (tr *TransactionRepository) GetTransactionsByNonce(chainID int64, sender string, nonce uint64) ([]Transaction, error) {
+	return tr.queryTransactions(fmt.Sprintf("SELECT %s FROM %s WHERE %s = $1 AND %s = $2 AND %s = $3 ORDER BY %s",
+		transactionColumns, TransactionsTable, TransactionsChainIDColumn, TransactionsSenderColumn,
+		TransactionsNonceColumn, TransactionsIDColumn), chainID, sender, nonce)
+}
+
+func (tr *TransactionRepository) GetTransaction(hash string) (Transaction, error) {
+	transactions, err := tr.queryTransactions(fmt.Sprintf("SELECT %s FROM %s WHERE %s = $1",
+		transactionColumns, TransactionsTable, TransactionsHashColumn), hash)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if len(transactions) == 0 {
+		return Transaction{}, fmt.Errorf("transaction %s not found", hash)
+	}
+
+	return transactions[0], nil
+}
+
+func (tr *TransactionRepository) queryTransactions(query string, args ...interface{}) ([]Transaction, error) {
+	rows, err := tr.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting transactions: %v", err)
+	}
+	defer rows.Close()
+
+	var transactions []Transaction
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions, rows.Err()
+}
+
+func scanTransaction(row interface {
+	Scan(dest ...interface{}) error
+}) (Transaction, error) {
+	var transaction Transaction
+	if err := row.Scan(&transaction.ID, &transaction.ChainID, &transaction.Sender, &transaction.Nonce,
+		&transaction.Hash, &transaction.Action, &transaction.Target, &transaction.Payload, &transaction.Status,
+		&transaction.BlockNumber, &transaction.LastError, &transaction.CreatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return Transaction{}, err
+		}
+		return Transaction{}, fmt.Errorf("error scanning transaction: %v", err)
+	}
+
+	return transaction, nil
+}
+
+func senderLockKey(chainID int64, sender string) int64 {
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "transactions %d %s", chainID, strings.ToLower(sender))
+	return int64(hash.Sum64())
+}
@@ -0,0 +1,14 @@
+package models
+
+type Transfer struct {
+	ContractAddress string
+	TxHash          string
+	LogIndex        uint
+	BlockNumber     uint64
+	BlockHash       string
+	From            string
+	To              string
+	TokenID         string
+	Kind            string
+	Status          int
+}
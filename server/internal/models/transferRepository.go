@@ -0,0 +1,120 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+const (
+	TransfersTable             = "transfers"
+	TransfersContractColumn    = "contract_address"
+	TransfersTxHashColumn      = "tx_hash"
+	TransfersLogIndexColumn    = "log_index"
+	TransfersBlockNumberColumn = "block_number"
+	TransfersBlockHashColumn   = "block_hash"
+	TransfersFromColumn        = "from_address"
+	TransfersToColumn          = "to_address"
+	TransfersTokenIDColumn     = "token_id"
+	TransfersKindColumn        = "kind"
+	TransfersStatusColumn      = "status"
+	PendingTransferStatus      = 0
+	ConfirmedTransferStatus    = 1
+	MintTransferKind           = "mint"
+	BurnTransferKind           = "burn"
+	RegularTransferKind        = "transfer"
+)
+
+type TransferRepository struct {
+	db *sql.DB
+}
+
+func NewTransferRepository(db *sql.DB) *TransferRepository {
+	return &TransferRepository{db}
+}
+
+// UpsertTransfer stores the transfer, keyed on (tx hash, log index), so that
+// redelivered logs overwrite the existing row instead of creating duplicates.
+// New rows start as pending; the status of an existing row is left untouched.
+func (tr *TransferRepository) UpsertTransfer(transfer Transfer) error {
+	query := fmt.Sprintf(`INSERT INTO %[1]s (%[2]s, %[3]s, %[4]s, %[5]s, %[6]s, %[7]s, %[8]s, %[9]s, %[10]s, %[11]s)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (%[2]s, %[3]s) DO UPDATE SET
+			%[4]s = EXCLUDED.%[4]s,
+			%[5]s = EXCLUDED.%[5]s,
+			%[6]s = EXCLUDED.%[6]s,
+			%[7]s = EXCLUDED.%[7]s,
+			%[8]s = EXCLUDED.%[8]s,
+			%[9]s = EXCLUDED.%[9]s,
+			%[11]s = EXCLUDED.%[11]s`,
+		TransfersTable, TransfersTxHashColumn, TransfersLogIndexColumn, TransfersBlockNumberColumn,
+		TransfersBlockHashColumn, TransfersFromColumn, TransfersToColumn, TransfersTokenIDColumn,
+		TransfersKindColumn, TransfersStatusColumn, TransfersContractColumn)
+
+	if _, err := tr.db.Exec(query, transfer.TxHash, transfer.LogIndex, transfer.BlockNumber,
+		transfer.BlockHash, transfer.From, transfer.To, transfer.TokenID, transfer.Kind, PendingTransferStatus, transfer.ContractAddress); err != nil {
+		return fmt.Errorf("error upserting transfer: %v", err)
+	}
+
+	return nil
+}
+
+// DeleteTransfersFromBlock removes every transfer of the contract recorded at
+// or above the given block and returns the number of removed rows.
+func (tr *TransferRepository) DeleteTransfersFromBlock(contractAddress string, blockNumber uint64) (int64, error) {
+	result, err := tr.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s = $1 AND %s >= $2",
+		TransfersTable, TransfersContractColumn, TransfersBlockNumberColumn), contractAddress, blockNumber)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting transfers from block %d: %v", blockNumber, err)
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error counting deleted transfers: %v", err)
+	}
+
+	return removed, nil
+}
+
+// ConfirmTransfers promotes every pending transfer at or below the given block.
+func (tr *TransferRepository) ConfirmTransfers(blockNumber uint64) (int64, error) {
+	result, err := tr.db.Exec(fmt.Sprintf("UPDATE %s SET %s = $1 WHERE %s = $2 AND %s <= $3",
+		TransfersTable, TransfersStatusColumn, TransfersStatusColumn, TransfersBlockNumberColumn),
+		ConfirmedTransferStatus, PendingTransferStatus, blockNumber)
+	if err != nil {
+		return 0, fmt.Errorf("error confirming transfers up to block %d: %v", blockNumber, err)
+	}
+
+	confirmed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error counting confirmed transfers: %v", err)
+	}
+
+	return confirmed, nil
+}
+
+func (tr *TransferRepository) GetTransfersByStatus(status int) ([]Transfer, error) {
+	rows, err := tr.db.Query(fmt.Sprintf("SELECT %s, %s, %s, %s, %s, %s, %s, %s, %s, %s FROM %s WHERE %s = $1 ORDER BY %s, %s",
+		TransfersContractColumn, TransfersTxHashColumn, TransfersLogIndexColumn, TransfersBlockNumberColumn, TransfersBlockHashColumn,
+		TransfersFromColumn, TransfersToColumn, TransfersTokenIDColumn, TransfersKindColumn, TransfersStatusColumn,
+		TransfersTable, TransfersStatusColumn, TransfersBlockNumberColumn, TransfersLogIndexColumn), status)
+	if err != nil {
+		return nil, fmt.Errorf("error getting transfers: %v", err)
+	}
+	defer rows.Close()
+
+	var transfers []Transfer
+	for rows.Next() {
+		var transfer Transfer
+		if err := rows.Scan(&transfer.ContractAddress, &transfer.TxHash, &transfer.LogIndex, &transfer.BlockNumber, &transfer.BlockHash,
+			&transfer.From, &transfer.To, &transfer.TokenID, &transfer.Kind, &transfer.Status); err != nil {
+			return nil, fmt.Errorf("error scanning transfer: %v", err)
+		}
+		transfers = append(transfers, transfer)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through transfers: %v", err)
+	}
+
+	return transfers, nil
+}
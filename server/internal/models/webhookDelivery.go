@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+type WebhookDelivery struct {
+	ID            int64
+	URL           string
+	EventKey      string
+	EventName     string
+	BlockNumber   uint64
+	Payload       string
+	Replay        bool
+	Status        int
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time
+}
@@ -0,0 +1,173 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	WebhookDeliveriesTable               = "webhook_deliveries"
+	WebhookDeliveriesIDColumn            = "id"
+	WebhookDeliveriesURLColumn           = "url"
+	WebhookDeliveriesEventKeyColumn      = "event_key"
+	WebhookDeliveriesEventNameColumn     = "event_name"
+	WebhookDeliveriesBlockNumberColumn   = "block_number"
+	WebhookDeliveriesPayloadColumn       = "payload"
+	WebhookDeliveriesReplayColumn        = "replay"
+	WebhookDeliveriesStatusColumn        = "status"
+	WebhookDeliveriesAttemptsColumn      = "attempts"
+	WebhookDeliveriesLastErrorColumn     = "last_error"
+	WebhookDeliveriesNextAttemptAtColumn = "next_attempt_at"
+	WebhookDeliveriesDeliveredAtColumn   = "delivered_at"
+	PendingDeliveryStatus                = 0
+	DeliveredDeliveryStatus              = 1
+	FailedDeliveryStatus                 = 2
+)
+
+var webhookDeliveryColumns = strings.Join([]string{
+	WebhookDeliveriesIDColumn, WebhookDeliveriesURLColumn, WebhookDeliveriesEventKeyColumn,
+	WebhookDeliveriesEventNameColumn, WebhookDeliveriesBlockNumberColumn, WebhookDeliveriesPayloadColumn,
+	WebhookDeliveriesReplayColumn, WebhookDeliveriesStatusColumn, WebhookDeliveriesAttemptsColumn,
+	fmt.Sprintf("COALESCE(%s, '')", WebhookDeliveriesLastErrorColumn), WebhookDeliveriesNextAttemptAtColumn,
+}, ", ")
+
+type WebhookDeliveryRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookDeliveryRepository(db *sql.DB) *WebhookDeliveryRepository {
+	return &WebhookDeliveryRepository{db}
+}
+
+// CreateDelivery adds the delivery to the outbox. An event that is already
+// queued for the same url is not queued again.
+func (wr *WebhookDeliveryRepository) CreateDelivery(delivery WebhookDelivery) error {
+	query := fmt.Sprintf(`INSERT INTO %s (%s, %s, %s, %s, %s, %s) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (%s, %s) DO NOTHING`,
+		WebhookDeliveriesTable, WebhookDeliveriesURLColumn, WebhookDeliveriesEventKeyColumn,
+		WebhookDeliveriesEventNameColumn, WebhookDeliveriesBlockNumberColumn, WebhookDeliveriesPayloadColumn,
+		WebhookDeliveriesReplayColumn, WebhookDeliveriesURLColumn, WebhookDeliveriesEventKeyColumn)
+
+	if _, err := wr.db.Exec(query, delivery.URL, delivery.EventKey, delivery.EventName,
+		delivery.BlockNumber, delivery.Payload, delivery.Replay); err != nil {
+		return fmt.Errorf("error creating webhook delivery: %v", err)
+	}
+
+	return nil
+}
+
+// ClaimDueDeliveries returns pending deliveries whose next attempt is due,
+// oldest first, and pushes their next attempt back by lease. Rows another
+// dispatcher is claiming are skipped, so a delivery is only claimed once until
+// the lease runs out or it is released.
+func (wr *WebhookDeliveryRepository) ClaimDueDeliveries(limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	deliveries, err := wr.queryDeliveries(fmt.Sprintf(`UPDATE %s SET %s = NOW() + make_interval(secs => $1)
+		WHERE %s IN (SELECT %s FROM %s WHERE %s = $2 AND %s <= NOW() ORDER BY %s LIMIT $3 FOR UPDATE SKIP LOCKED)
+		RETURNING %s`,
+		WebhookDeliveriesTable, WebhookDeliveriesNextAttemptAtColumn, WebhookDeliveriesIDColumn,
+		WebhookDeliveriesIDColumn, WebhookDeliveriesTable, WebhookDeliveriesStatusColumn,
+		WebhookDeliveriesNextAttemptAtColumn, WebhookDeliveriesIDColumn, webhookDeliveryColumns),
+		lease.Seconds(), PendingDeliveryStatus, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID < deliveries[j].ID })
+	return deliveries, nil
+}
+
+// ReleaseDeliveries makes claimed deliveries that are still pending due again.
+func (wr *WebhookDeliveryRepository) ReleaseDeliveries(ids []int64) error {
+	if _, err := wr.db.Exec(fmt.Sprintf("UPDATE %s SET %s = NOW() WHERE %s = ANY($1) AND %s = $2",
+		WebhookDeliveriesTable, WebhookDeliveriesNextAttemptAtColumn, WebhookDeliveriesIDColumn,
+		WebhookDeliveriesStatusColumn), pq.Array(ids), PendingDeliveryStatus); err != nil {
+		return fmt.Errorf("error releasing webhook deliveries: %v", err)
+	}
+
+	return nil
+}
+
+func (wr *WebhookDeliveryRepository) GetDeliveriesByStatus(status int) ([]WebhookDelivery, error) {
+	return wr.queryDeliveries(fmt.Sprintf("SELECT %s FROM %s WHERE %s = $1 ORDER BY %s",
+		webhookDeliveryColumns, WebhookDeliveriesTable, WebhookDeliveriesStatusColumn,
+		WebhookDeliveriesIDColumn), status)
+}
+
+func (wr *WebhookDeliveryRepository) MarkDelivered(id int64, attempts int) error {
+	if _, err := wr.db.Exec(fmt.Sprintf("UPDATE %s SET %s = $1, %s = $2, %s = NULL, %s = NOW() WHERE %s = $3",
+		WebhookDeliveriesTable, WebhookDeliveriesStatusColumn, WebhookDeliveriesAttemptsColumn,
+		WebhookDeliveriesLastErrorColumn, WebhookDeliveriesDeliveredAtColumn, WebhookDeliveriesIDColumn),
+		DeliveredDeliveryStatus, attempts, id); err != nil {
+		return fmt.Errorf("error marking webhook delivery %d as delivered: %v", id, err)
+	}
+
+	return nil
+}
+
+// MarkAttemptFailed records a failed attempt. The delivery stays pending until
+// nextAttemptAt unless status is FailedDeliveryStatus.
+func (wr *WebhookDeliveryRepository) MarkAttemptFailed(id int64, status, attempts int, lastError string, nextAttemptAt time.Time) error {
+	if _, err := wr.db.Exec(fmt.Sprintf("UPDATE %s SET %s = $1, %s = $2, %s = $3, %s = $4 WHERE %s = $5",
+		WebhookDeliveriesTable, WebhookDeliveriesStatusColumn, WebhookDeliveriesAttemptsColumn,
+		WebhookDeliveriesLastErrorColumn, WebhookDeliveriesNextAttemptAtColumn, WebhookDeliveriesIDColumn),
+		status, attempts, lastError, nextAttemptAt, id); err != nil {
+		return fmt.Errorf("error recording failed webhook delivery %d: %v", id, err)
+	}
+
+	return nil
+}
+
+// RetryFailedDeliveries queues failed deliveries again. With no ids every
+// failed delivery is retried.
+func (wr *WebhookDeliveryRepository) RetryFailedDeliveries(ids []int64) (int64, error) {
+	query := fmt.Sprintf("UPDATE %s SET %s = $1, %s = 0, %s = NOW() WHERE %s = $2",
+		WebhookDeliveriesTable, WebhookDeliveriesStatusColumn, WebhookDeliveriesAttemptsColumn,
+		WebhookDeliveriesNextAttemptAtColumn, WebhookDeliveriesStatusColumn)
+	args := []interface{}{PendingDeliveryStatus, FailedDeliveryStatus}
+	if len(ids) > 0 {
+		query += fmt.Sprintf(" AND %s = ANY($3)", WebhookDeliveriesIDColumn)
+		args = append(args, pq.Array(ids))
+	}
+
+	result, err := wr.db.Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("error retrying webhook deliveries: %v", err)
+	}
+
+	retried, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error counting retried webhook deliveries: %v", err)
+	}
+
+	return retried, nil
+}
+
+func (wr *WebhookDeliveryRepository) queryDeliveries(query string, args ...interface{}) ([]WebhookDelivery, error) {
+	rows, err := wr.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting webhook deliveries: %v", err)
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		var delivery WebhookDelivery
+		if err := rows.Scan(&delivery.ID, &delivery.URL, &delivery.EventKey, &delivery.EventName,
+			&delivery.BlockNumber, &delivery.Payload, &delivery.Replay, &delivery.Status, &delivery.Attempts,
+			&delivery.LastError, &delivery.NextAttemptAt); err != nil {
+			return nil, fmt.Errorf("error scanning webhook delivery: %v", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through webhook deliveries: %v", err)
+	}
+
+	return deliveries, nil
+}
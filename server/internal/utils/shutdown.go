@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// Shutdown cancels its context on SIGINT or SIGTERM and exits the process
+// once the work started with Begin has finished. A second signal exits
+// immediately.
+type Shutdown struct {
+	ctx     context.Context
+	running sync.Mutex
+	cleanup func()
+}
+
+// HandleShutdown installs the signal handler. cleanup runs right before the
+// process exits.
+func HandleShutdown(cleanup func()) *Shutdown {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	s := &Shutdown{ctx: ctx, cleanup: cleanup}
+
+	go func() {
+		<-ctx.Done()
+		stop()
+
+		fmt.Println("\nShutting down...")
+		s.running.Lock()
+		cleanup()
+		os.Exit(0)
+	}()
+
+	return s
+}
+
+// Begin marks the start of work the shutdown has to wait for. The returned
+// context is cancelled on a signal and done has to be called once the work
+// stopped.
+func (s *Shutdown) Begin() (ctx context.Context, done func()) {
+	s.running.Lock()
+	return s.ctx, s.running.Unlock
+}
+
+// Exit runs the cleanup and exits with code. Work that decides the exit code
+// itself calls it instead of done, so a signal cannot exit with 0 first.
+func (s *Shutdown) Exit(code int) {
+	s.cleanup()
+	os.Exit(code)
+}
@@ -3,8 +3,11 @@ package utils
 import (
 	"bufio"
 	"fmt"
+	"math/rand"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 )
@@ -18,6 +21,28 @@ const (
 	DBName              = "DATABASE_NAME"
 	DBUser              = "DATABASE_USER"
 	DBPassword          = "DATABASE_USER_PASSWORD"
+	ListenerStartBlock  = "LISTENER_START_BLOCK"
+	ListenerChunkSize   = "LISTENER_BACKFILL_CHUNK_SIZE"
+	ListenerConfirms    = "LISTENER_CONFIRMATIONS"
+	ListenerFinalized   = "LISTENER_USE_FINALIZED_TAG"
+	ListenerPollPeriod  = "LISTENER_POLL_INTERVAL"
+	ListenerContracts   = "LISTENER_CONTRACTS"
+	ListenerEvents      = "LISTENER_EVENTS"
+	ListenerFilterFrom  = "LISTENER_FILTER_FROM"
+	ListenerFilterTo    = "LISTENER_FILTER_TO"
+	ListenerFilterToken = "LISTENER_FILTER_TOKEN_IDS"
+	WebhookURLs         = "WEBHOOK_URLS"
+	WebhookSecret       = "WEBHOOK_SECRET"
+	IPFSGatewayURL      = "IPFS_GATEWAY_URL"
+	MetricsAddress      = "METRICS_ADDRESS"
+	AdminSyncInterval   = "ADMIN_SYNC_INTERVAL"
+	AdminStuckAfter     = "ADMIN_STUCK_AFTER"
+	AdminMaxGasPrice    = "ADMIN_MAX_GAS_PRICE"
+	AdminPlanMaxAge     = "ADMIN_PLAN_MAX_AGE"
+	HealthMaxHeadAge    = "HEALTH_MAX_HEAD_AGE"
+	HealthMaxLag        = "HEALTH_MAX_LAG"
+	FeedAddress         = "FEED_ADDRESS"
+	FeedAllowedOrigins  = "FEED_ALLOWED_ORIGINS"
 )
 
 func PromptAddress(fn func(string) error) func(...string) error {
@@ -34,6 +59,23 @@ func PromptContractAddress() (string, error) {
 	return handleAddressPrompt("Enter contract address: ")
 }
 
+// PromptConfirm asks a yes or no question, defaulting to no.
+func PromptConfirm(prompt string) (bool, error) {
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Print(prompt + " [y/N]: ")
+	input, err := reader.ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(input)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
 func handleAddressPrompt(prompt string) (string, error) {
 	reader := bufio.NewReader(os.Stdin)
 	for {
@@ -53,3 +95,67 @@ func handleAddressPrompt(prompt string) (string, error) {
 func EnvHelper(key string) string {
 	return os.Getenv(key)
 }
+
+// EnvListHelper splits a comma separated variable, dropping empty entries.
+func EnvListHelper(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func EnvUintHelper(key string, defaultValue uint64) (uint64, error) {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	parsed, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q for %s: %v", value, key, err)
+	}
+
+	return parsed, nil
+}
+
+func EnvBoolHelper(key string) (bool, error) {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return false, nil
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid value %q for %s: %v", value, key, err)
+	}
+
+	return parsed, nil
+}
+
+// Backoff returns an exponentially growing delay for the given retry attempt,
+// capped at maxDelay, with up to half of it randomized as jitter.
+func Backoff(attempt int, baseDelay, maxDelay time.Duration) time.Duration {
+	delay := maxDelay
+	if attempt < 32 && baseDelay<<uint(attempt) < maxDelay {
+		delay = baseDelay << uint(attempt)
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func EnvDurationHelper(key string, defaultValue time.Duration) (time.Duration, error) {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q for %s: %v", value, key, err)
+	}
+
+	return parsed, nil
+}
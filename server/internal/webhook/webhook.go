@@ -0,0 +1,188 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"erc-721-checks/internal/listener"
+	"erc-721-checks/internal/models"
+	"erc-721-checks/internal/utils"
+)
+
+const (
+	SignatureHeader = "X-Checks-Signature"
+	EventHeader     = "X-Checks-Event"
+	DeliveryHeader  = "X-Checks-Delivery"
+	ReplayHeader    = "X-Checks-Replay"
+
+	requestTimeout = 10 * time.Second
+	pollInterval   = 5 * time.Second
+	batchSize      = 50
+	maxAttempts    = 10
+	minRetryDelay  = 5 * time.Second
+	maxRetryDelay  = time.Hour
+	// claimLease covers delivering a whole batch, after which deliveries a
+	// dispatcher claimed but never finished are due again.
+	claimLease = batchSize * requestTimeout
+)
+
+// Sink queues every event for each configured url in the Postgres outbox. The
+// Dispatcher delivers them, so nothing is lost if the process stops.
+type Sink struct {
+	urls       []string
+	repository *models.WebhookDeliveryRepository
+}
+
+func NewSink(urls []string, repository *models.WebhookDeliveryRepository) *Sink {
+	return &Sink{urls: urls, repository: repository}
+}
+
+func (s *Sink) Send(event listener.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %v", err)
+	}
+
+	for _, url := range s.urls {
+		if err := s.repository.CreateDelivery(models.WebhookDelivery{
+			URL:         url,
+			EventKey:    event.Key(),
+			EventName:   event.Name,
+			BlockNumber: event.BlockNumber,
+			Payload:     string(payload),
+			Replay:      event.Replay,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type Dispatcher struct {
+	secret     []byte
+	repository *models.WebhookDeliveryRepository
+	client     *http.Client
+}
+
+func NewDispatcher(secret string, repository *models.WebhookDeliveryRepository) *Dispatcher {
+	return &Dispatcher{
+		secret:     []byte(secret),
+		repository: repository,
+		client:     &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// Run delivers due outbox entries until ctx is cancelled. Deliveries are
+// claimed first, so two dispatchers, e.g. an old and a new leader, never send
+// the same one at once. On cancellation the request in progress is aborted
+// and the unfinished deliveries are released without counting an attempt.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		deliveries, err := d.repository.ClaimDueDeliveries(batchSize, claimLease)
+		if err != nil {
+			fmt.Printf("failed to load webhook deliveries: %v\n", err)
+			continue
+		}
+
+		for i, delivery := range deliveries {
+			if ctx.Err() != nil || !d.deliver(ctx, delivery) {
+				d.release(deliveries[i:])
+				return
+			}
+		}
+	}
+}
+
+// deliver sends the delivery and records the attempt. It returns false when
+// the request was aborted by ctx, in which case nothing is recorded.
+func (d *Dispatcher) deliver(ctx context.Context, delivery models.WebhookDelivery) bool {
+	attempts := delivery.Attempts + 1
+
+	if err := d.post(ctx, delivery); err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+
+		status := models.PendingDeliveryStatus
+		if attempts >= maxAttempts {
+			status = models.FailedDeliveryStatus
+			fmt.Printf("Webhook delivery %d to %s failed permanently: %v\n\n", delivery.ID, delivery.URL, err)
+		}
+
+		nextAttemptAt := time.Now().Add(utils.Backoff(attempts-1, minRetryDelay, maxRetryDelay))
+		if err := d.repository.MarkAttemptFailed(delivery.ID, status, attempts, err.Error(), nextAttemptAt); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+		return true
+	}
+
+	if err := d.repository.MarkDelivered(delivery.ID, attempts); err != nil {
+		fmt.Printf("%v\n", err)
+	}
+	return true
+}
+
+func (d *Dispatcher) release(deliveries []models.WebhookDelivery) {
+	ids := make([]int64, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		ids = append(ids, delivery.ID)
+	}
+	if err := d.repository.ReleaseDeliveries(ids); err != nil {
+		fmt.Printf("%v\n", err)
+	}
+}
+
+func (d *Dispatcher) post(ctx context.Context, delivery models.WebhookDelivery) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(SignatureHeader, "sha256="+Sign(d.secret, []byte(delivery.Payload)))
+	request.Header.Set(EventHeader, delivery.EventName)
+	request.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	if delivery.Replay {
+		request.Header.Set(ReplayHeader, "true")
+	}
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status: %s", response.Status)
+	}
+
+	return nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the body, which receivers compare
+// against the SignatureHeader value.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}